@@ -0,0 +1,104 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// Bounds of the number of frames averaged by calibrate_extrinsics.
+const (
+	CalibrationFramesDefault = 10
+	maxCalibrationFrames     = 1000
+)
+
+// extrinsics is the pose of the camera relative to the ground, measured from the ground plane.
+type extrinsics struct {
+	// Height is the distance from the camera to the ground in mm, and HeightStdDev its standard deviation
+	// over the frames.
+	Height, HeightStdDev float64
+	// Pitch is the angle in degrees of the optical axis (+Z) above the horizon, and Roll the angle in degrees
+	// from the top of the image (-Y) to the up direction seen in the image, positive towards +X.
+	Pitch, Roll float64
+	// Up is the unit normal of the ground in the camera frame, pointing to the camera.
+	Up r3.Vector
+	// FramesUsed is the number of frames a ground plane was found in.
+	FramesUsed int
+	// Pose is the pose of the camera in a frame on the ground below it, with +Z up and +X along the optical
+	// axis seen from above.
+	Pose spatialmath.Pose
+}
+
+// calibrateExtrinsics finds the ground plane in the given number of clouds from next, and returns the pose of
+// the camera relative to the average plane. The frames without a ground plane are skipped.
+func calibrateExtrinsics(
+	ctx context.Context, next func(context.Context) (pc.PointCloud, error), cfg *ErCCLConfig, frames int,
+) (*extrinsics, error) {
+	var upSum r3.Vector
+	heights := make([]float64, 0, frames)
+	for range frames {
+		cloud, err := next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		plane, _, _, err := findGroundPlane(ctx, cloud, cfg, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if plane == nil {
+			continue
+		}
+		// n.p + d = 0 with n a unit vector, the camera is at the origin so it is d away from the plane on
+		// the side n points to if d is positive
+		eq := plane.Equation()
+		normal := r3.Vector{X: eq[0], Y: eq[1], Z: eq[2]}
+		scale := 1 / normal.Norm()
+		if eq[3] < 0 {
+			scale = -scale
+		}
+		upSum = upSum.Add(normal.Mul(scale))
+		heights = append(heights, eq[3]*scale)
+	}
+	if len(heights) == 0 {
+		return nil, errors.New("no ground plane was found in any frame")
+	}
+
+	res := &extrinsics{Up: upSum.Normalize(), FramesUsed: len(heights)}
+	for _, h := range heights {
+		res.Height += h
+	}
+	res.Height /= float64(len(heights))
+	for _, h := range heights {
+		res.HeightStdDev += (h - res.Height) * (h - res.Height)
+	}
+	res.HeightStdDev = math.Sqrt(res.HeightStdDev / float64(len(heights)))
+	res.Pitch = math.Asin(math.Max(-1, math.Min(1, res.Up.Z))) * 180 / math.Pi
+	res.Roll = math.Atan2(res.Up.X, -res.Up.Y) * 180 / math.Pi
+
+	// the ground frame, in the camera frame. Its X is the optical axis seen from above, or the top of the image
+	// if the camera looks straight up or down
+	forward := r3.Vector{Z: 1}
+	if math.Abs(res.Up.Z) > 0.99 {
+		forward = r3.Vector{Y: -1}
+	}
+	forward = forward.Sub(res.Up.Mul(forward.Dot(res.Up))).Normalize()
+	left := res.Up.Cross(forward)
+	// the rows of a spatialmath rotation matrix are the axes of the rotated frame, here the camera axes
+	// expressed in the ground frame
+	orientation, err := spatialmath.NewRotationMatrix([]float64{
+		forward.X, left.X, res.Up.X,
+		forward.Y, left.Y, res.Up.Y,
+		forward.Z, left.Z, res.Up.Z,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res.Pose = spatialmath.NewPose(r3.Vector{Z: res.Height}, orientation)
+	return res, nil
+}
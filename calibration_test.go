@@ -0,0 +1,134 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/robot/framesystem"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/testutils/inject"
+)
+
+// groundView returns a cloud of the ground seen from a camera height mm above it, looking pitch degrees above
+// the horizon and turned roll degrees about its optical axis.
+func groundView(t *testing.T, height, pitch, roll float64) pc.PointCloud {
+	t.Helper()
+	p, r := pitch*math.Pi/180, roll*math.Pi/180
+	up := r3.Vector{X: math.Sin(r) * math.Cos(p), Y: -math.Cos(r) * math.Cos(p), Z: math.Sin(p)}
+	return scene{
+		groundMin:  r3.Vector{X: -1000, Y: -1000},
+		groundMax:  r3.Vector{X: 1000, Y: 1000},
+		groundStep: 20,
+		height:     func(_, _ float64) float64 { return -height },
+		toSensor:   newGroundFrame(up).toSensor,
+	}.cloud(t)
+}
+
+func TestCalibrateExtrinsics(t *testing.T) {
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MaxDistFromPlane: 5, NormalVec: r3.Vector{Y: -1}, AngleTolerance: 60}
+	cfg.SetDefaultValues()
+	for _, tc := range []struct{ pitch, roll float64 }{{-30, 0}, {-45, 10}, {20, -15}} {
+		// the height changes a little from frame to frame
+		heights := []float64{998, 1000, 1002}
+		k := 0
+		next := func(ctx context.Context) (pc.PointCloud, error) {
+			cloud := groundView(t, heights[k%len(heights)], tc.pitch, tc.roll)
+			k++
+			return cloud, nil
+		}
+		ext, err := calibrateExtrinsics(context.Background(), next, cfg, 3)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, ext.FramesUsed, test.ShouldEqual, 3)
+		test.That(t, ext.Height, test.ShouldAlmostEqual, 1000, 1e-3)
+		test.That(t, ext.HeightStdDev, test.ShouldAlmostEqual, math.Sqrt(8./3), 1e-3)
+		test.That(t, ext.Pitch, test.ShouldAlmostEqual, tc.pitch, 1e-3)
+		test.That(t, ext.Roll, test.ShouldAlmostEqual, tc.roll, 1e-3)
+
+		// the camera is above the ground, with its optical axis pointing forward at the pitch
+		test.That(t, ext.Pose.Point().Z, test.ShouldAlmostEqual, 1000, 1e-3)
+		axis := spatialmath.Compose(ext.Pose, spatialmath.NewPoseFromPoint(r3.Vector{Z: 1})).Point().Sub(ext.Pose.Point())
+		p := tc.pitch * math.Pi / 180
+		test.That(t, axis.X, test.ShouldAlmostEqual, math.Cos(p), 1e-6)
+		test.That(t, axis.Y, test.ShouldAlmostEqual, 0, 1e-6)
+		test.That(t, axis.Z, test.ShouldAlmostEqual, math.Sin(p), 1e-6)
+		up := spatialmath.Compose(ext.Pose, spatialmath.NewPoseFromPoint(ext.Up)).Point().Sub(ext.Pose.Point())
+		test.That(t, up.Z, test.ShouldAlmostEqual, 1, 1e-6)
+	}
+
+	next := func(ctx context.Context) (pc.PointCloud, error) {
+		return pc.NewBasicEmpty(), nil
+	}
+	_, err := calibrateExtrinsics(context.Background(), next, cfg, 2)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no ground plane")
+}
+
+func TestCalibrateExtrinsicsCommand(t *testing.T) {
+	cam := &inject.Camera{}
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return groundView(t, 1500, -20, 0), nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:        500,
+		MaxDistFromPlane:     5,
+		AngleTolerance:       30,
+		GroundPlaneNormalVec: NormalVec{Y: -1},
+		DefaultCamera:        "fakeCamera",
+	}
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_calibration"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	resp, err := service.DoCommand(context.Background(), map[string]interface{}{"command": "calibrate_extrinsics", "frames": 2.})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["frames_used"], test.ShouldEqual, 2)
+	test.That(t, resp["height_mm"], test.ShouldAlmostEqual, 1500, 1e-3)
+	test.That(t, resp["pitch_degs"], test.ShouldAlmostEqual, -20, 1e-3)
+	test.That(t, resp["roll_degs"], test.ShouldAlmostEqual, 0, 1e-3)
+	pose := resp["suggested_pose"].(map[string]interface{})
+	test.That(t, pose["translation"].(map[string]interface{})["z"], test.ShouldAlmostEqual, 1500, 1e-3)
+	test.That(t, pose["orientation"].(map[string]interface{})["type"], test.ShouldEqual, "ov_degrees")
+
+	_, err = service.DoCommand(context.Background(), map[string]interface{}{"command": "calibrate_extrinsics", "frames": 0.})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "frames must be between")
+}
+
+func TestCalibrateExtrinsicsOutputFrame(t *testing.T) {
+	p := -20 * math.Pi / 180
+	// the camera looks along +X of the world, pitched down, 1.5 m above the ground. The rows are its axes in the
+	// world, its X to the right of the image and its Z along the optical axis
+	orientation, err := spatialmath.NewRotationMatrix([]float64{
+		0, -1, 0,
+		math.Sin(p), 0, -math.Cos(p),
+		math.Cos(p), 0, math.Sin(p),
+	})
+	test.That(t, err, test.ShouldBeNil)
+	pose := spatialmath.NewPose(r3.Vector{Z: 1500}, orientation)
+	cam := inject.NewCamera("fakeCamera")
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return groundView(t, 1500, -20, 0), nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam, framesystem.PublicServiceName: worldFrameSystem(t, pose)}
+	// the ground normal is +Z of the output frame, which is not the up direction of the camera
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:    500,
+		MaxDistFromPlane: 5,
+		AngleTolerance:   30,
+		OutputFrame:      "world",
+		DefaultCamera:    "fakeCamera",
+	}
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_calibration"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	resp, err := service.DoCommand(context.Background(), map[string]interface{}{"command": "calibrate_extrinsics", "frames": 2.})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["frames_used"], test.ShouldEqual, 2)
+	test.That(t, resp["height_mm"], test.ShouldAlmostEqual, 1500, 1e-3)
+	test.That(t, resp["pitch_degs"], test.ShouldAlmostEqual, -20, 1e-3)
+	test.That(t, resp["roll_degs"], test.ShouldAlmostEqual, 0, 1e-3)
+}
@@ -0,0 +1,54 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// nextClouds gets the next point clouds of the cameras at the same time.
+func nextClouds(ctx context.Context, cams []camera.Camera) ([]pc.PointCloud, error) {
+	clouds := make([]pc.PointCloud, len(cams))
+	errs := make([]error, len(cams))
+	var wg sync.WaitGroup
+	for i, cam := range cams {
+		wg.Go(func() {
+			clouds[i], errs[i] = cam.NextPointCloud(ctx, nil)
+		})
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get the point cloud of camera %q", cams[i].Name().ShortName())
+		}
+	}
+	return clouds, nil
+}
+
+// mergeClouds returns the points of all the clouds in one cloud. The clouds have to be in the same frame.
+func mergeClouds(ctx context.Context, clouds []pc.PointCloud) (pc.PointCloud, error) {
+	size := 0
+	for _, cloud := range clouds {
+		size += cloud.Size()
+	}
+	merged := pc.NewBasicPointCloud(size)
+	for _, cloud := range clouds {
+		var setErr error
+		err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+			setErr = merged.Set(p, d)
+			return setErr == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if setErr != nil {
+			return nil, setErr
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,94 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/referenceframe"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/robot/framesystem"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/testutils/inject"
+)
+
+func TestCameraNames(t *testing.T) {
+	// two cameras 1 m above the ground of the world, looking in opposite directions
+	poses := map[string]spatialmath.Pose{
+		"front": spatialmath.NewPose(r3.Vector{X: 100, Z: 1000}, &spatialmath.OrientationVectorDegrees{OZ: 1}),
+		"back":  spatialmath.NewPose(r3.Vector{X: -100, Z: 1000}, &spatialmath.OrientationVectorDegrees{OZ: 1, Theta: 180}),
+	}
+	fs := inject.NewFrameSystemService("fs")
+	fs.GetPoseFunc = func(
+		ctx context.Context, componentName, destinationFrame string, _ []*referenceframe.LinkInFrame, _ map[string]interface{},
+	) (*referenceframe.PoseInFrame, error) {
+		test.That(t, destinationFrame, test.ShouldEqual, "world")
+		return referenceframe.NewPoseInFrame(destinationFrame, poses[componentName]), nil
+	}
+	// each camera sees the ground and the half of a box on its side of the world
+	box := r3.Vector{X: 0, Y: 400, Z: 100}
+	deps := resource.Dependencies{framesystem.PublicServiceName: fs}
+	for name, pose := range poses {
+		front := name == "front"
+		toCamera := func(p r3.Vector) r3.Vector {
+			return spatialmath.Compose(spatialmath.PoseInverse(pose), spatialmath.NewPoseFromPoint(p)).Point()
+		}
+		// the points of the box 10 mm apart, from -50 to -10 behind the box's center and from 0 to 40 in front of it
+		half := sceneBox{
+			min:  box.Add(r3.Vector{X: -50, Y: -50, Z: -80}),
+			max:  box.Add(r3.Vector{X: -10, Y: 50, Z: 80}),
+			step: r3.Vector{X: 10, Y: 10, Z: 20},
+		}
+		if front {
+			half.min.X, half.max.X = box.X, box.X+40
+		}
+		cloud := scene{
+			groundMin:  r3.Vector{X: -1000, Y: -1000},
+			groundMax:  r3.Vector{X: 1000, Y: 1000},
+			groundStep: 10,
+			hole:       func(x, _ float64) bool { return (x >= 0) != front },
+			boxes:      []sceneBox{half},
+			toSensor:   toCamera,
+		}.cloud(t)
+		cam := inject.NewCamera(name)
+		cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+			return cloud, nil
+		}
+		deps[camera.Named(name)] = cam
+	}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 10,
+		GridResolution:   20,
+		CameraNames:      []string{"front", "back"},
+	}
+	_, _, err := params.Validate("path")
+	test.That(t, err.Error(), test.ShouldContainSubstring, "output_frame")
+	params.OutputFrame = "world"
+	validDeps, _, err := params.Validate("path")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, validDeps, test.ShouldResemble, []string{"front", "back", framesystem.PublicServiceName.String()})
+	params.CameraNames = []string{"front", "front"}
+	_, _, err = params.Validate("path")
+	test.That(t, err.Error(), test.ShouldContainSubstring, "more than once")
+	params.CameraNames = []string{"front", "back"}
+
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_cameras"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	// the default camera is the first one, and the box seen by both cameras is one object
+	objects, err := service.GetObjectPointClouds(context.Background(), "", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+	test.That(t, objects[0].PointCloud.Size(), test.ShouldEqual, 10*11*9)
+	center := pc.CloudCentroid(objects[0].PointCloud)
+	test.That(t, center.X, test.ShouldAlmostEqual, box.X-5, 1)
+	test.That(t, center.Y, test.ShouldAlmostEqual, box.Y, 1)
+	test.That(t, center.Z, test.ShouldAlmostEqual, box.Z, 1)
+}
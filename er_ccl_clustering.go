@@ -3,6 +3,9 @@ package obstaclespointcloud
 import (
 	"context"
 	"math"
+	"runtime"
+	"sync"
+	"time"
 
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/golang/geo/r3"
@@ -11,15 +14,17 @@ import (
 	"go.viam.com/rdk/components/camera"
 	pc "go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/spatialmath"
 	"go.viam.com/rdk/utils"
 	"go.viam.com/rdk/vision"
 	"go.viam.com/rdk/vision/segmentation"
 )
 
-// MaxCCLIterations is a value to stop the CCL algo from going on for too long.
+// GridSize is the default number of cells along each side of the clustering grid, the rest are the
+// default values of the ErCCLConfig.
 const (
-	MaxCCLIterations            = 300000
 	GridSize                    = 200
+	ClusteringAlphaDefault      = 0.9
 	MinPtsInPlaneDefault        = 500
 	MinPtsInSegmentDefault      = 10
 	MaxDistFromPlaneDefault     = 100
@@ -28,18 +33,74 @@ const (
 	ClusteringStrictnessDefault = 1
 )
 
+// DegradedLabel is the label given to the objects found by a run that ran short of max_processing_time_ms.
+const DegradedLabel = "degraded"
+
+const (
+	// ctxCheckInterval is the number of points processed between two checks of the context.
+	ctxCheckInterval = 1024
+	// groundPlaneBudgetShare is the share of max_processing_time_ms after which the ground plane
+	// search stops trying new candidate planes.
+	groundPlaneBudgetShare = 0.6
+	// degradedMaxPoints is the number of points the non-ground cloud is downsampled to when
+	// max_processing_time_ms is used up before clustering.
+	degradedMaxPoints = 5000
+)
+
+// Neighborhood is the shape of the area around a grid cell that is searched for cells of the same cluster.
+type Neighborhood string
+
+// The neighborhood shapes. The quadrant only looks r-1 cells down and right of a cell, and so misses cells
+// that touch diagonally down and left. The square and the disk look r-1 cells in every direction.
+const (
+	NeighborhoodQuadrant Neighborhood = "quadrant"
+	NeighborhoodSquare   Neighborhood = "square"
+	NeighborhoodDisk     Neighborhood = "disk"
+)
+
 // ErCCLConfig specifies the necessary parameters to apply the
 // connected components based clustering algo.
 type ErCCLConfig struct {
 	resource.TriviallyValidateConfig
-	MinPtsInPlane        int       `json:"min_points_in_plane"`
-	MinPtsInSegment      int       `json:"min_points_in_segment"`
-	MaxDistFromPlane     float64   `json:"max_dist_from_plane_mm"`
-	NormalVec            r3.Vector `json:"ground_plane_normal_vec"`
-	AngleTolerance       float64   `json:"ground_angle_tolerance_degs"`
-	ClusteringRadius     int       `json:"clustering_radius"`
-	ClusteringStrictness float64   `json:"clustering_strictness"`
-	DefaultCamera        string    `json:"camera_name"`
+	MinPtsInPlane                  int                `json:"min_points_in_plane"`
+	MinPtsInSegment                int                `json:"min_points_in_segment"`
+	MaxDistFromPlane               float64            `json:"max_dist_from_plane_mm"`
+	NormalVec                      r3.Vector          `json:"ground_plane_normal_vec"`
+	AngleTolerance                 float64            `json:"ground_angle_tolerance_degs"`
+	ClusteringRadius               int                `json:"clustering_radius"`
+	ClusteringStrictness           float64            `json:"clustering_strictness"`
+	ClusteringAlpha                float64            `json:"clustering_alpha"`
+	GridResolution                 float64            `json:"grid_resolution_mm"`
+	GridCells                      int                `json:"grid_cells"`
+	ClusteringWorkers              int                `json:"clustering_workers"`
+	MaxProcessingTime              int                `json:"max_processing_time_ms"`
+	Neighborhood                   Neighborhood       `json:"clustering_neighborhood"`
+	ObstacleGeometry               ObstacleGeometry   `json:"obstacle_geometry"`
+	MaxPlanesToRemove              int                `json:"max_planes_to_remove"`
+	PlaneOrientations              []PlaneOrientation `json:"plane_orientations"`
+	PlaneAngleTolerance            float64            `json:"plane_angle_tolerance_degs"`
+	GroundSegmentation             GroundSegmentation `json:"ground_segmentation"`
+	GroundZoneSize                 float64            `json:"ground_zone_size_mm"`
+	NegativeObstacles              bool               `json:"negative_obstacles"`
+	NegativeObstacleDepth          float64            `json:"negative_obstacle_depth_mm"`
+	NegativeObstacleMaxGap         float64            `json:"negative_obstacle_max_gap_mm"`
+	NegativeObstacleResolution     float64            `json:"negative_obstacle_resolution_mm"`
+	NegativeObstacleExtent         float64            `json:"negative_obstacle_extent_mm"`
+	VoxelSize                      float64            `json:"voxel_size_mm"`
+	VoxelMode                      VoxelMode          `json:"voxel_mode"`
+	FullResolutionObjects          bool               `json:"full_resolution_objects"`
+	StatisticalOutlierRemoval      bool               `json:"statistical_outlier_removal"`
+	StatisticalOutlierNeighbors    int                `json:"statistical_outlier_neighbors"`
+	StatisticalOutlierStdDev       float64            `json:"statistical_outlier_std_dev"`
+	RadiusOutlierRemoval           bool               `json:"radius_outlier_removal"`
+	RadiusOutlierRadius            float64            `json:"radius_outlier_radius_mm"`
+	RadiusOutlierMinNeighbors      int                `json:"radius_outlier_min_neighbors"`
+	RangeAdaptiveClustering        RangeCurve         `json:"range_adaptive_clustering"`
+	ClusteringMode                 ClusteringMode     `json:"clustering_mode"`
+	RangeImageVerticalResolution   float64            `json:"range_image_vertical_resolution_degs"`
+	RangeImageHorizontalResolution float64            `json:"range_image_horizontal_resolution_degs"`
+	RangeImageAngleThreshold       float64            `json:"range_image_angle_threshold_degs"`
+	DefaultCamera                  string             `json:"camera_name"`
 }
 
 type node struct {
@@ -68,13 +129,13 @@ func (erCCL *ErCCLConfig) SetDefaultValues() {
 	}
 
 	// ground_plane_normal_vec
-	// going to have to add that the ground plane's normal vec has to be {0, 1, 0} or {0, 0, 1}
-	if !erCCL.NormalVec.IsUnit() {
-		erCCL.NormalVec = r3.Vector{X: 0, Y: 0, Z: 1}
-	}
+	// any direction is allowed, it only has to be non-zero. The clustering grid is aligned to it.
 	if erCCL.NormalVec.Norm2() == 0 {
 		erCCL.NormalVec = r3.Vector{X: 0, Y: 0, Z: 1}
 	}
+	if !erCCL.NormalVec.IsUnit() {
+		erCCL.NormalVec = erCCL.NormalVec.Normalize()
+	}
 
 	// ground_angle_tolerance_degs
 	if erCCL.AngleTolerance == 0.0 {
@@ -94,6 +155,112 @@ func (erCCL *ErCCLConfig) SetDefaultValues() {
 		erCCL.ClusteringStrictness = ClusteringStrictnessDefault
 	}
 
+	// clustering_alpha
+	if erCCL.ClusteringAlpha == 0 {
+		erCCL.ClusteringAlpha = ClusteringAlphaDefault
+	}
+	if erCCL.ClusteringAlpha > 1 || erCCL.ClusteringAlpha < 0 {
+		erCCL.ClusteringAlpha = ClusteringAlphaDefault
+	}
+
+	// grid_resolution_mm and grid_cells, an absolute cell size wins over a number of cells
+	if erCCL.GridResolution < 0 {
+		erCCL.GridResolution = 0
+	}
+	if erCCL.GridCells <= 0 {
+		erCCL.GridCells = GridSize
+	}
+
+	// clustering_workers
+	if erCCL.ClusteringWorkers <= 0 {
+		erCCL.ClusteringWorkers = runtime.NumCPU()
+	}
+
+	// clustering_neighborhood
+	if erCCL.Neighborhood == "" {
+		erCCL.Neighborhood = NeighborhoodQuadrant
+	}
+
+	// obstacle_geometry
+	if erCCL.ObstacleGeometry == "" {
+		erCCL.ObstacleGeometry = GeometryBox
+	}
+
+	// max_planes_to_remove, the ground plane is always looked for
+	if erCCL.MaxPlanesToRemove <= 0 {
+		erCCL.MaxPlanesToRemove = MaxPlanesToRemoveDefault
+	}
+
+	// plane_angle_tolerance_degs
+	if erCCL.PlaneAngleTolerance <= 0 || erCCL.PlaneAngleTolerance > 90 {
+		erCCL.PlaneAngleTolerance = PlaneAngleToleranceDefault
+	}
+
+	// ground_segmentation and ground_zone_size_mm
+	if erCCL.GroundSegmentation == "" {
+		erCCL.GroundSegmentation = GroundPlane
+	}
+	if erCCL.GroundZoneSize <= 0 {
+		erCCL.GroundZoneSize = GroundZoneSizeDefault
+	}
+
+	// negative_obstacle_depth_mm, negative_obstacle_max_gap_mm, negative_obstacle_resolution_mm and
+	// negative_obstacle_extent_mm
+	if erCCL.NegativeObstacleDepth <= 0 {
+		erCCL.NegativeObstacleDepth = NegativeObstacleDepthDefault
+	}
+	if erCCL.NegativeObstacleMaxGap <= 0 {
+		erCCL.NegativeObstacleMaxGap = NegativeObstacleMaxGapDefault
+	}
+	if erCCL.NegativeObstacleResolution <= 0 {
+		erCCL.NegativeObstacleResolution = NegativeObstacleResolutionDefault
+	}
+	if erCCL.NegativeObstacleExtent <= 0 {
+		erCCL.NegativeObstacleExtent = NegativeObstacleExtentDefault
+	}
+
+	// voxel_size_mm, 0 means no downsampling, and voxel_mode
+	if erCCL.VoxelSize < 0 {
+		erCCL.VoxelSize = 0
+	}
+	if erCCL.VoxelMode == "" {
+		erCCL.VoxelMode = VoxelCentroid
+	}
+
+	// statistical_outlier_neighbors, statistical_outlier_std_dev, radius_outlier_radius_mm and
+	// radius_outlier_min_neighbors
+	if erCCL.StatisticalOutlierNeighbors <= 0 {
+		erCCL.StatisticalOutlierNeighbors = StatisticalOutlierNeighborsDefault
+	}
+	if erCCL.StatisticalOutlierStdDev <= 0 {
+		erCCL.StatisticalOutlierStdDev = StatisticalOutlierStdDevDefault
+	}
+	if erCCL.RadiusOutlierRadius <= 0 {
+		erCCL.RadiusOutlierRadius = RadiusOutlierRadiusDefault
+	}
+	if erCCL.RadiusOutlierMinNeighbors <= 0 {
+		erCCL.RadiusOutlierMinNeighbors = RadiusOutlierMinNeighborsDefault
+	}
+
+	// clustering_mode and the resolutions and angle threshold of the range image
+	if erCCL.ClusteringMode == "" {
+		erCCL.ClusteringMode = ClusteringGrid
+	}
+	if erCCL.RangeImageVerticalResolution <= 0 {
+		erCCL.RangeImageVerticalResolution = RangeImageVerticalResolutionDefault
+	}
+	if erCCL.RangeImageHorizontalResolution <= 0 {
+		erCCL.RangeImageHorizontalResolution = RangeImageHorizontalResolutionDefault
+	}
+	if erCCL.RangeImageAngleThreshold <= 0 || erCCL.RangeImageAngleThreshold >= 90 {
+		erCCL.RangeImageAngleThreshold = RangeImageAngleThresholdDefault
+	}
+
+	// max_processing_time_ms, 0 means no limit
+	if erCCL.MaxProcessingTime < 0 {
+		erCCL.MaxProcessingTime = 0
+	}
+
 }
 
 // ConvertAttributes changes the AttributeMap input into an ErCCLConfig.
@@ -136,29 +303,203 @@ func (erCCL *ErCCLConfig) ErCCLAlgorithm(ctx context.Context, src camera.Camera)
 }
 
 // ApplyERCCLToPointCloud clusters a point cloud according to the ER-CCL algorithm.
+// The clustering grid is built in a frame aligned with the ground plane, so the sensor can be mounted
+// at any angle. The returned objects are in the frame of the original point cloud.
+// If max_processing_time_ms runs short, the objects are found with fewer ground plane candidates or fewer
+// points, and are labeled DegradedLabel.
 func ApplyERCCLToPointCloud(ctx context.Context, cloud pc.PointCloud, cfg *ErCCLConfig) ([]*vision.Object, error) {
+	res, err := segmentERCCL(ctx, cloud, r3.Vector{}, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.objects, nil
+}
+
+// erCCLResult is the outcome of one run of the ER-CCL pipeline.
+type erCCLResult struct {
+	objects []*vision.Object
+	// plane is the ground plane, nil if none was found, and ground the frame the clustering grid was built in
+	plane  pc.Plane
+	ground groundFrame
+	// extraPlanes are the other planes removed before clustering, in the order they were found
+	extraPlanes []pc.Plane
+	// obstaclePoints are all the points above the ground plane, including the ones of pruned clusters, and
+	// negatives the drops found below it, which are also at the end of objects
+	obstaclePoints pc.PointCloud
+	negatives      []*vision.Object
+	// degraded is set if the run ran short of max_processing_time_ms and cut corners to finish in time
+	degraded bool
+}
+
+// segmentERCCL runs the ER-CCL pipeline on a point cloud, with the sensor at the given position in the frame of
+// the cloud. Every stage stops as soon as ctx is done. If planes is not nil, the ground plane is looked for in
+// it before running RANSAC.
+func segmentERCCL(
+	ctx context.Context, cloud pc.PointCloud, sensor r3.Vector, cfg *ErCCLConfig, planes *planeCache,
+) (*erCCLResult, error) {
+	budget := newProcessingBudget(cfg.MaxProcessingTime)
+	res := &erCCLResult{}
+
+	// one point per voxel, the points of the voxels are kept if the objects are returned at full resolution
+	var voxels *voxelGrid
+	if cfg.VoxelSize > 0 {
+		size := cloud.Size()
+		var err error
+		cloud, voxels, err = voxelDownsample(ctx, cloud, cfg.VoxelSize, cfg.VoxelMode, cfg.FullResolutionObjects)
+		if err != nil {
+			return nil, err
+		}
+		// the planes are found among the voxels, so the number of points they need is scaled by the mean number
+		// of points in a voxel, as the segments are pruned by the points of their voxels
+		if size > 0 {
+			scaled := *cfg
+			scaled.MinPtsInPlane = cfg.MinPtsInPlane * cloud.Size() / size
+			cfg = &scaled
+		}
+	}
+
 	// run ransac, get pointcloud without ground plane
-	ps := segmentation.NewPointCloudGroundPlaneSegmentation(cloud, cfg.MaxDistFromPlane, cfg.MinPtsInPlane, cfg.AngleTolerance, cfg.NormalVec)
 	// if there are found planes, remove them, and keep all the non-plane points
-	_, nonPlane, err := ps.FindGroundPlane(ctx)
+	findPlane := findGroundPlane
+	if planes != nil {
+		findPlane = planes.findGroundPlane
+	}
+	if cfg.GroundSegmentation == GroundZones {
+		findPlane = func(ctx context.Context, cloud pc.PointCloud, cfg *ErCCLConfig, _ time.Time) (pc.Plane, pc.PointCloud, bool, error) {
+			plane, nonPlane, err := segmentTerrain(ctx, cloud, sensor, cfg)
+			return plane, nonPlane, false, err
+		}
+	}
+	plane, nonPlane, capped, err := findPlane(ctx, cloud, cfg, budget.deadline(groundPlaneBudgetShare))
 	if err != nil {
 		return nil, err
 	}
+	res.degraded = capped
+	res.plane = plane
+	// the ground of the zones has no single normal, the plane fit to all of it is tilted by the average slope,
+	// and a tilted grid would cut the obstacles standing on it across its cells
+	normal := groundNormal(plane, cfg.NormalVec)
+	if cfg.GroundSegmentation == GroundZones {
+		normal = cfg.NormalVec
+	}
+	ground := newGroundFrame(normal)
+	ground.origin = sensor
+	res.ground = ground
+
+	// peel off the other large planes, like walls and tables
+	if cfg.MaxPlanesToRemove > 1 {
+		res.extraPlanes, nonPlane, capped, err = removePlanes(ctx, nonPlane, ground.normal, cfg,
+			budget.deadline(groundPlaneBudgetShare))
+		if err != nil {
+			return nil, err
+		}
+		res.degraded = res.degraded || capped
+	}
+
+	// out of time already, cluster fewer points
+	if budget.exhausted() && nonPlane.Size() > degradedMaxPoints {
+		nonPlane, err = downsample(ctx, nonPlane, degradedMaxPoints)
+		if err != nil {
+			return nil, err
+		}
+		res.degraded = true
+	}
+
+	// the isolated points, like flying pixels along the edges of objects, would make small false obstacles
+	if cfg.StatisticalOutlierRemoval {
+		nonPlane, err = removeStatisticalOutliers(ctx, nonPlane, cfg.StatisticalOutlierNeighbors, cfg.StatisticalOutlierStdDev)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RadiusOutlierRemoval {
+		nonPlane, err = removeRadiusOutliers(ctx, nonPlane, cfg.RadiusOutlierRadius, cfg.RadiusOutlierMinNeighbors)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the points far below the ground are drops, they are not clustered with the obstacles
+	var below pc.PointCloud
+	if cfg.NegativeObstacles && plane != nil {
+		below, nonPlane, err = splitBelowGround(ctx, nonPlane, plane, ground, cfg.NegativeObstacleDepth)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// need to figure out coordinate system
-	// if height is not y, then height is going to be z
-	heightIsY := cfg.NormalVec.Y != 0
+	res.obstaclePoints = nonPlane
 
-	// calculating s value, want GridSize x GridSize graph
-	resolution := math.Ceil((nonPlane.MetaData().MaxX - nonPlane.MetaData().MinX) / GridSize)
-	if heightIsY {
-		resolution = math.Ceil((math.Ceil((nonPlane.MetaData().MaxZ-nonPlane.MetaData().MinZ)/GridSize) + resolution) / 2)
+	var segments map[int]pc.PointCloud
+	if cfg.ClusteringMode == ClusteringRangeImage {
+		segments, err = rangeImageSegments(ctx, nonPlane, ground, cfg)
 	} else {
-		resolution = math.Ceil((math.Ceil((nonPlane.MetaData().MaxY-nonPlane.MetaData().MinY)/GridSize) + resolution) / 2)
+		segments, err = gridSegments(ctx, nonPlane, ground, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// prune smaller clusters. Default minimum number of points determined by size of original point cloud.
+	// The points of a downsampled cloud are counted with all the points of their voxels.
+	size := func(cloud pc.PointCloud) int { return cloud.Size() }
+	if voxels != nil {
+		size = voxels.pointCount
+	}
+	minPtsInSegment := int(math.Max(float64(size(nonPlane))/float64(cfg.GridCells), 10.0))
+	if cfg.MinPtsInSegment != 0 {
+		minPtsInSegment = cfg.MinPtsInSegment
+	}
+	label := ""
+	if res.degraded {
+		label = DegradedLabel
+	}
+	res.objects = make([]*vision.Object, 0, len(segments))
+	for _, cloud := range segments {
+		if len(cfg.RangeAdaptiveClustering) > 0 {
+			minPtsInSegment = cfg.RangeAdaptiveClustering.minPoints(pc.CloudCentroid(cloud), ground)
+		}
+		if size(cloud) >= minPtsInSegment {
+			geometry, err := obstacleGeometry(cloud, ground, cfg.ObstacleGeometry, label)
+			if err != nil {
+				return nil, err
+			}
+			res.objects = append(res.objects, &vision.Object{PointCloud: cloud, Geometry: geometry})
+		}
+	}
+	if voxels != nil && cfg.FullResolutionObjects {
+		if err := voxels.fullResolution(ctx, res.objects); err != nil {
+			return nil, err
+		}
+	}
+	if below != nil {
+		res.negatives, err = negativeObstacles(ctx, res, below, nonPlane, cfg)
+		if err != nil {
+			return nil, err
+		}
+		res.objects = append(res.objects, res.negatives...)
+	}
+	return res, nil
+}
+
+// gridSegments clusters the points of the cloud with ER-CCL on a grid on the ground, and returns the points of
+// each label.
+func gridSegments(
+	ctx context.Context, nonPlane pc.PointCloud, ground groundFrame, cfg *ErCCLConfig,
+) (map[int]pc.PointCloud, error) {
+	// express the cloud in a frame where the ground normal is +Z, height is then always Z and the grid is on X and Y
+	aligned, err := ground.toGroundFrame(ctx, nonPlane)
+	if err != nil {
+		return nil, err
 	}
 
+	// calculating s value, the size of a cell in mm
+	resolution := gridResolution(aligned.MetaData(), cfg)
+
 	// create obstacle flag map, return that 2d slice of nodes
-	labelMap := pcProjection(nonPlane, resolution, heightIsY)
+	labelMap, err := pcProjection(ctx, aligned, resolution)
+	if err != nil {
+		return nil, err
+	}
 
 	// actually run erCCLL
 	// iterate through every box, searching down and right r distance
@@ -166,21 +507,26 @@ func ApplyERCCLToPointCloud(ctx context.Context, cloud pc.PointCloud, cfg *ErCCL
 	// if similar enough update to initial label value (will also be smallest)
 	// iterate through pointcloud
 
-	err = LabelMapUpdate(labelMap, cfg.ClusteringRadius, 0.9, cfg.ClusteringStrictness, resolution)
+	if len(cfg.RangeAdaptiveClustering) > 0 {
+		// the radius of a cell grows with its distance to the sensor
+		radii := cfg.RangeAdaptiveClustering.cellRadii(labelMap, aligned.MetaData(), resolution)
+		err = labelMapUpdate(ctx, labelMap, func(i, j int) int { return radii[i][j] }, cfg.RangeAdaptiveClustering.maxRadius(),
+			cfg.ClusteringAlpha, cfg.ClusteringStrictness, resolution, cfg.ClusteringWorkers, cfg.Neighborhood)
+	} else {
+		err = LabelMapUpdate(ctx, labelMap, cfg.ClusteringRadius, cfg.ClusteringAlpha, cfg.ClusteringStrictness, resolution,
+			cfg.ClusteringWorkers, cfg.Neighborhood)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// look up label value of point by looking at 2d array and seeing what label inside that struct
-	// set this label
+	// set this label. The original point is kept so the objects stay in the sensor frame.
 	var iterateErr error
 	segments := make(map[int]pc.PointCloud)
-	nonPlane.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
-		i := int(math.Ceil((p.X - nonPlane.MetaData().MinX) / resolution))
-		j := int(math.Ceil((p.Z - nonPlane.MetaData().MinZ) / resolution))
-		if !heightIsY {
-			j = int(math.Ceil((p.Y - nonPlane.MetaData().MinY) / resolution))
-		}
+	alignedMeta := aligned.MetaData()
+	err = iterateWithContext(ctx, nonPlane, func(p r3.Vector, d pc.Data) bool {
+		i, j := gridCell(ground.fromSensor(p), alignedMeta, resolution)
 		_, ok := segments[labelMap[i][j].label]
 		if !ok {
 			segments[labelMap[i][j].label] = pc.NewBasicEmpty()
@@ -192,52 +538,428 @@ func ApplyERCCLToPointCloud(ctx context.Context, cloud pc.PointCloud, cfg *ErCCL
 		}
 		return true
 	})
+	if err != nil {
+		return nil, err
+	}
 	if iterateErr != nil {
 		return nil, iterateErr
 	}
-	// prune smaller clusters. Default minimum number of points determined by size of original point cloud.
-	minPtsInSegment := int(math.Max(float64(nonPlane.Size())/float64(GridSize), 10.0))
-	if cfg.MinPtsInSegment != 0 {
-		minPtsInSegment = cfg.MinPtsInSegment
+	return segments, nil
+}
+
+// processingBudget is the time a run of the pipeline has, from max_processing_time_ms.
+type processingBudget struct {
+	start time.Time
+	limit time.Duration
+}
+
+func newProcessingBudget(limitMs int) processingBudget {
+	return processingBudget{start: time.Now(), limit: time.Duration(limitMs) * time.Millisecond}
+}
+
+// deadline returns the time at which the given share of the budget is used up, or the zero time if there is no limit.
+func (b processingBudget) deadline(share float64) time.Time {
+	if b.limit <= 0 {
+		return time.Time{}
 	}
-	validObjects := make([]*vision.Object, 0, len(segments))
-	for _, cloud := range segments {
-		if cloud.Size() >= minPtsInSegment {
-			obj, err := vision.NewObject(cloud)
-			if err != nil {
-				return nil, err
+	return b.start.Add(time.Duration(share * float64(b.limit)))
+}
+
+// exhausted returns whether the whole budget is used up.
+func (b processingBudget) exhausted() bool {
+	return b.limit > 0 && time.Since(b.start) >= b.limit
+}
+
+// iterateWithContext iterates over the points of the cloud like Iterate, but stops and returns the
+// error of ctx once it is done.
+func iterateWithContext(ctx context.Context, cloud pc.PointCloud, fn func(p r3.Vector, d pc.Data) bool) error {
+	var err error
+	count := 0
+	cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		if count%ctxCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
 			}
-			validObjects = append(validObjects, obj)
 		}
+		count++
+		return fn(p, d)
+	})
+	return err
+}
+
+// downsample keeps every k-th point of the cloud so that it has at most maxPoints points.
+func downsample(ctx context.Context, cloud pc.PointCloud, maxPoints int) (pc.PointCloud, error) {
+	k := int(math.Ceil(float64(cloud.Size()) / float64(maxPoints)))
+	if k <= 1 {
+		return cloud, nil
+	}
+	sampled := pc.NewBasicPointCloud(maxPoints)
+	var setErr error
+	count := 0
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		if count%k == 0 {
+			setErr = sampled.Set(p, d)
+		}
+		count++
+		return setErr == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if setErr != nil {
+		return nil, setErr
 	}
-	return validObjects, nil
+	return sampled, nil
 }
 
-// LabelMapUpdate updates the label map until it converges or errors.
-func LabelMapUpdate(labelMap [][]node, r int, alpha, beta, s float64) error {
-	i := 0
-	continueRunning := true
-	for continueRunning {
-		// 0.9 is alpha
-		continueRunning := minimumSearch(labelMap, r, 0.9, beta, s)
-		if !continueRunning {
-			break
+// gridResolution returns the size of a grid cell in mm. It is grid_resolution_mm if it is set, otherwise
+// it is chosen so the ground aligned cloud fits in about grid_cells x grid_cells cells, and is at least 1 mm,
+// and large enough for the clustering radius to reach the neighboring voxels of a downsampled cloud.
+func gridResolution(meta pc.MetaData, cfg *ErCCLConfig) float64 {
+	if cfg.GridResolution > 0 {
+		return cfg.GridResolution
+	}
+	cells := float64(cfg.GridCells)
+	if cells <= 0 {
+		cells = GridSize
+	}
+	resolution := math.Ceil((meta.MaxX - meta.MinX) / cells)
+	resolution = math.Ceil((math.Ceil((meta.MaxY-meta.MinY)/cells) + resolution) / 2)
+	// a cloud with no extent, like a single point left by the filters, still needs cells of some size
+	resolution = max(resolution, 1)
+	if cfg.VoxelSize > 0 {
+		radius := cfg.ClusteringRadius
+		if len(cfg.RangeAdaptiveClustering) > 0 {
+			radius = cfg.RangeAdaptiveClustering.minRadius()
 		}
+		// the points of a downsampled cloud are a voxel apart, and the neighbors of a cell are less than radius
+		// cells away, each voxel would be an object of its own otherwise
+		resolution = max(resolution, math.Ceil(cfg.VoxelSize/float64(max(radius-1, 1))))
+	}
+	return resolution
+}
+
+// groundNormal returns the unit normal the clustering grid should be aligned with. The normal of the plane
+// found by RANSAC is preferred, flipped if needed so it points the same way as the configured normal.
+// If no plane was found, the configured normal is used.
+func groundNormal(plane pc.Plane, configured r3.Vector) r3.Vector {
+	configured = configured.Normalize()
+	if plane == nil {
+		return configured
+	}
+	found := plane.Normal()
+	if found.Norm2() == 0 {
+		return configured
+	}
+	found = found.Normalize()
+	if found.Dot(configured) < 0 {
+		found = found.Mul(-1)
+	}
+	return found
+}
+
+// groundFrame is an orthonormal basis whose third axis is the ground normal, centered on the sensor. A point
+// expressed in it has its height above the ground as Z, so the clustering grid can always be built on X and Y.
+// The sensor frame is the frame of the point cloud, which is the output frame if one is configured.
+type groundFrame struct {
+	x, y, normal r3.Vector
+	// origin is the position of the sensor in the sensor frame, zero unless the cloud is in an output frame
+	origin r3.Vector
+}
+
+// newGroundFrame returns the ground frame for the given ground normal, centered on the origin. Its X axis is the
+// X axis of the sensor projected on the ground, so a small change of the normal only turns it a little.
+func newGroundFrame(normal r3.Vector) groundFrame {
+	return newGroundFrameAlong(normal, r3.Vector{X: 1})
+}
+
+// newGroundFrameAlong returns the ground frame for the given ground normal whose X axis is axis projected on the
+// ground. If axis is closer to the normal than to the ground, the X or Y axis of the sensor that is the closest
+// to the ground is projected instead.
+func newGroundFrameAlong(normal, axis r3.Vector) groundFrame {
+	n := normal.Normalize()
+	project := func(v r3.Vector) r3.Vector { return v.Sub(n.Mul(v.Dot(n))) }
+	x := project(axis)
+	if x.Norm2() < 0.5*axis.Norm2() {
+		x = project(r3.Vector{X: 1})
+		if y := project(r3.Vector{Y: 1}); y.Norm2() > x.Norm2() {
+			x = y
+		}
+	}
+	x = x.Normalize()
+	return groundFrame{x: x, y: n.Cross(x), normal: n}
+}
+
+// fromSensor expresses a point of the sensor frame in the ground frame.
+func (g groundFrame) fromSensor(p r3.Vector) r3.Vector {
+	p = p.Sub(g.origin)
+	return r3.Vector{X: p.Dot(g.x), Y: p.Dot(g.y), Z: p.Dot(g.normal)}
+}
+
+// toSensor expresses a point of the ground frame in the sensor frame.
+func (g groundFrame) toSensor(p r3.Vector) r3.Vector {
+	return g.directionToSensor(p).Add(g.origin)
+}
+
+// directionToSensor expresses a direction of the ground frame in the sensor frame.
+func (g groundFrame) directionToSensor(v r3.Vector) r3.Vector {
+	return g.x.Mul(v.X).Add(g.y.Mul(v.Y)).Add(g.normal.Mul(v.Z))
+}
+
+// orientation returns the orientation, in the sensor frame, of the ground frame turned by angle radians
+// about the ground normal.
+func (g groundFrame) orientation(angle float64) (spatialmath.Orientation, error) {
+	axisX := g.directionToSensor(r3.Vector{X: math.Cos(angle), Y: math.Sin(angle)})
+	axisY := g.normal.Cross(axisX)
+	// the rows of a spatialmath rotation matrix are the axes of the rotated frame
+	return spatialmath.NewRotationMatrix([]float64{
+		axisX.X, axisX.Y, axisX.Z,
+		axisY.X, axisY.Y, axisY.Z,
+		g.normal.X, g.normal.Y, g.normal.Z,
+	})
+}
+
+// toGroundFrame returns a new point cloud with every point of the given cloud expressed in the ground frame.
+func (g groundFrame) toGroundFrame(ctx context.Context, cloud pc.PointCloud) (pc.PointCloud, error) {
+	aligned := pc.NewBasicPointCloud(cloud.Size())
+	var setErr error
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		setErr = aligned.Set(g.fromSensor(p), d)
+		return setErr == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if setErr != nil {
+		return nil, setErr
+	}
+	return aligned, nil
+}
 
-		if i > MaxCCLIterations { // arbitrary cutoff for iterations
-			return errors.New("could not converge, change parameters")
+// gridCell returns the indices of the grid cell a ground aligned point falls into.
+func gridCell(p r3.Vector, meta pc.MetaData, s float64) (int, int) {
+	i := int(math.Ceil((p.X - meta.MinX) / s))
+	j := int(math.Ceil((p.Y - meta.MinY) / s))
+	return i, j
+}
+
+// LabelMapUpdate labels the connected components of the label map using a disjoint-set.
+// Two occupied cells are connected if one is in the neighborhood of radius r of the other and they are
+// similarEnough. Every cell of a component ends up with the smallest label found in that component.
+// The grid is split into row strips that are labeled by up to workers goroutines, then the strips
+// are merged along their borders, so the result does not depend on the number of workers.
+// It stops and returns the error of ctx once ctx is done.
+func LabelMapUpdate(
+	ctx context.Context, labelMap [][]node, r int, alpha, beta, s float64, workers int, shape Neighborhood,
+) error {
+	return labelMapUpdate(ctx, labelMap, func(int, int) int { return r }, r, alpha, beta, s, workers, shape)
+}
+
+// labelMapUpdate is LabelMapUpdate with a radius for every cell, given by radius, which is at most maxR. Two
+// cells are looked at with the larger of their radii, so the links do not depend on which one comes first.
+func labelMapUpdate(
+	ctx context.Context, labelMap [][]node, radius func(i, j int) int, maxR int, alpha, beta, s float64, workers int,
+	shape Neighborhood,
+) error {
+	offsets, err := neighborhoodOffsets(shape, maxR)
+	if err != nil {
+		return err
+	}
+	if len(labelMap) == 0 {
+		return nil
+	}
+	h, w := len(labelMap), len(labelMap[0])
+	sets := newDisjointSet(h * w)
+	strips := rowStrips(h, workers)
+	// each strip only links cells inside of itself, so the goroutines never touch the same sets
+	var wg sync.WaitGroup
+	for _, strip := range strips {
+		wg.Go(func() {
+			unionNeighbors(ctx, labelMap, sets, strip, strip, offsets, radius, maxR, shape, alpha, beta, s)
+		})
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// merge the strips by linking the cells that have neighbors past the bottom of their strip
+	for _, strip := range strips[:len(strips)-1] {
+		border := rowRange{start: max(strip.start, strip.end-maxR+1), end: strip.end}
+		unionNeighbors(ctx, labelMap, sets, border, rowRange{start: strip.end, end: h}, offsets, radius, maxR, shape,
+			alpha, beta, s)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// find the smallest label of every component, then give it to all of its cells
+	minLabels := make(map[int]int)
+	for i, curNodeSlice := range labelMap {
+		for j, curNode := range curNodeSlice {
+			if curNode.label == -1 {
+				continue
+			}
+			root := sets.find(i*w + j)
+			if minLabel, ok := minLabels[root]; !ok || curNode.label < minLabel {
+				minLabels[root] = curNode.label
+			}
+		}
+	}
+	for i, curNodeSlice := range labelMap {
+		for j, curNode := range curNodeSlice {
+			if curNode.label == -1 {
+				continue
+			}
+			labelMap[i][j].label = minLabels[sets.find(i*w+j)]
 		}
-		i++
 	}
 	return nil
 }
 
-func pcProjection(cloud pc.PointCloud, s float64, heightIsY bool) [][]node {
-	h := int(math.Ceil((cloud.MetaData().MaxX-cloud.MetaData().MinX)/s)) + 1
-	w := int(math.Ceil((cloud.MetaData().MaxZ-cloud.MetaData().MinZ)/s)) + 1
-	if !heightIsY {
-		w = int(math.Ceil((cloud.MetaData().MaxY-cloud.MetaData().MinY)/s)) + 1
+// rowRange is the half open range of rows [start, end) of the label map.
+type rowRange struct {
+	start, end int
+}
+
+// rowStrips splits h rows into at most n strips of about the same size.
+func rowStrips(h, n int) []rowRange {
+	n = max(1, min(n, h))
+	strips := make([]rowRange, 0, n)
+	for k := 0; k < n; k++ {
+		strips = append(strips, rowRange{start: k * h / n, end: (k + 1) * h / n})
+	}
+	return strips
+}
+
+// offset is the position of a neighbor relative to a cell of the label map.
+type offset struct {
+	di, dj int
+}
+
+// within returns whether the offset is in the neighborhood of the given shape and radius.
+func (o offset) within(shape Neighborhood, r int) bool {
+	if shape == NeighborhoodDisk {
+		return o.di*o.di+o.dj*o.dj < r*r
+	}
+	return o.di < r && o.dj < r && -o.dj < r
+}
+
+// neighborhoodOffsets returns the offsets of the neighbors of a cell for the given shape and radius.
+// Linking cells is symmetric, so for the square and the disk only the neighbors after the cell in
+// row-major order are returned. No offset goes up a row, which the row strips rely on.
+func neighborhoodOffsets(shape Neighborhood, r int) ([]offset, error) {
+	offsets := make([]offset, 0)
+	for di := 0; di < r; di++ {
+		for dj := -(r - 1); dj < r; dj++ {
+			if di == 0 && dj <= 0 {
+				continue
+			}
+			switch shape {
+			case NeighborhoodQuadrant:
+				if dj < 0 {
+					continue
+				}
+			case NeighborhoodSquare:
+			case NeighborhoodDisk:
+				if di*di+dj*dj >= r*r {
+					continue
+				}
+			default:
+				return nil, errors.Errorf("unknown clustering neighborhood %q", shape)
+			}
+			offsets = append(offsets, offset{di: di, dj: dj})
+		}
 	}
+	return offsets, nil
+}
+
+// unionNeighbors links every occupied cell in rows to its similar neighbors, only looking at
+// neighbors that are in neighborRows. The offsets are those of the neighborhood of radius maxR, a pair of
+// cells with smaller radii only looks at the offsets in their own neighborhood. It stops early once ctx is done.
+func unionNeighbors(
+	ctx context.Context, labelMap [][]node, sets *disjointSet, rows, neighborRows rowRange, offsets []offset,
+	radius func(i, j int) int, maxR int, shape Neighborhood, alpha, beta, s float64,
+) {
+	w := len(labelMap[0])
+	for i := rows.start; i < rows.end; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		for j, curNode := range labelMap[i] {
+			if curNode.label == -1 {
+				// skip if no points at cell
+				continue
+			}
+			r := radius(i, j)
+			for _, o := range offsets {
+				newI, newJ := i+o.di, j+o.dj
+				if newI < neighborRows.start || newI >= neighborRows.end || newJ < 0 || newJ >= w {
+					continue
+				}
+				neighbor := labelMap[newI][newJ]
+				if neighbor.label == -1 {
+					continue
+				}
+				pairR := r
+				if pairR < maxR {
+					pairR = max(pairR, radius(newI, newJ))
+					if !o.within(shape, pairR) {
+						continue
+					}
+				}
+				if similarEnough(curNode, neighbor, pairR, alpha, beta, s) {
+					sets.union(i*w+j, newI*w+newJ)
+				}
+			}
+		}
+	}
+}
+
+// disjointSet is a union-find structure over the cells of the label map, indexed by i*w + j.
+type disjointSet struct {
+	parent []int
+	rank   []uint8
+}
+
+func newDisjointSet(n int) *disjointSet {
+	ds := &disjointSet{parent: make([]int, n), rank: make([]uint8, n)}
+	for i := range ds.parent {
+		ds.parent[i] = i
+	}
+	return ds
+}
+
+// find returns the root of the set containing x, halving the path along the way.
+func (ds *disjointSet) find(x int) int {
+	for ds.parent[x] != x {
+		ds.parent[x] = ds.parent[ds.parent[x]]
+		x = ds.parent[x]
+	}
+	return x
+}
+
+// union merges the sets containing a and b.
+func (ds *disjointSet) union(a, b int) {
+	rootA, rootB := ds.find(a), ds.find(b)
+	if rootA == rootB {
+		return
+	}
+	switch {
+	case ds.rank[rootA] < ds.rank[rootB]:
+		ds.parent[rootA] = rootB
+	case ds.rank[rootA] > ds.rank[rootB]:
+		ds.parent[rootB] = rootA
+	default:
+		ds.parent[rootB] = rootA
+		ds.rank[rootA]++
+	}
+}
+
+// pcProjection projects a ground aligned point cloud onto a 2D grid of cells of size s.
+// The grid is built on X and Y, and each cell keeps the height range (Z) of its points.
+func pcProjection(ctx context.Context, cloud pc.PointCloud, s float64) ([][]node, error) {
+	meta := cloud.MetaData()
+	h := int(math.Ceil((meta.MaxX-meta.MinX)/s)) + 1
+	w := int(math.Ceil((meta.MaxY-meta.MinY)/s)) + 1
 	h = max(0, h)
 	w = max(0, w)
 	retVal := make([][]node, h)
@@ -252,73 +974,19 @@ func pcProjection(cloud pc.PointCloud, s float64, heightIsY bool) [][]node {
 			retVal[i][j] = curNode
 		}
 	}
-	cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
-		i := int(math.Ceil((p.X - cloud.MetaData().MinX) / s))
-		j := int(math.Ceil((p.Z - cloud.MetaData().MinZ) / s))
-		var curNode node
-		if heightIsY {
-			curNode = retVal[i][j]
-			curNode.maxHeight = math.Max(curNode.maxHeight, p.Y)
-			curNode.minHeight = math.Min(curNode.minHeight, p.Y)
-		} else {
-			j = int(math.Ceil((p.Y - cloud.MetaData().MinY) / s))
-			curNode = retVal[i][j]
-			curNode.maxHeight = math.Max(curNode.maxHeight, p.Z)
-			curNode.minHeight = math.Min(curNode.minHeight, p.Z)
-		}
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		i, j := gridCell(p, meta, s)
+		curNode := retVal[i][j]
+		curNode.maxHeight = math.Max(curNode.maxHeight, p.Z)
+		curNode.minHeight = math.Min(curNode.minHeight, p.Z)
 		curNode.label = i*w + j
 		retVal[i][j] = curNode
 		return true
 	})
-	return retVal
-}
-
-// minimumSearch updates the label map 'once' meaning it searches from every cell once.
-func minimumSearch(labelMap [][]node, r int, alpha, beta, s float64) bool {
-	mapChanged := false
-
-	for i, curNodeSlice := range labelMap {
-		for j, curNode := range curNodeSlice {
-			if curNode.label == -1 {
-				// skip if no points at cell
-				continue
-			}
-			minLabel := curNode.label
-			neighbors := make([]node, 0)
-			// finding neighbors + finding min label value
-			for x := 0; x < r; x++ {
-				newI := i + x
-				if newI >= len(labelMap) {
-					break
-				}
-				for y := 0; y < r; y++ {
-					newJ := j + y
-					if newJ >= len(curNodeSlice) {
-						break
-					}
-					if newI == i && newJ == j {
-						continue // might be able to remove this because original should be in neighbors list
-					}
-					neighborNode := labelMap[newI][newJ]
-					if similarEnough(curNode, neighborNode, r, alpha, beta, s) {
-						neighbors = append(neighbors, neighborNode)
-						minLabel = int(math.Min(float64(minLabel), float64(neighborNode.label)))
-					}
-				}
-			}
-			if minLabel != curNode.label {
-				mapChanged = true
-				labelMap[curNode.i][curNode.j].label = minLabel
-			}
-			for _, neighbor := range neighbors {
-				if neighbor.label != minLabel {
-					mapChanged = true
-					labelMap[neighbor.i][neighbor.j].label = minLabel
-				}
-			}
-		}
+	if err != nil {
+		return nil, err
 	}
-	return mapChanged
+	return retVal, nil
 }
 
 // similarEnough takes in two nodes and tries to see if they meet some similarity threshold
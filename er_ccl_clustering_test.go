@@ -0,0 +1,412 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// tiltedScene builds a cloud of a flat ground with two box shaped obstacles on it, as seen by a sensor
+// whose ground normal is the given vector. It returns the cloud and the centers of the two obstacles
+// in the sensor frame.
+func tiltedScene(t *testing.T, normal r3.Vector) (pc.PointCloud, []r3.Vector) {
+	t.Helper()
+	s := scene{
+		groundMax:  r3.Vector{X: 400, Y: 400},
+		groundStep: 10,
+		boxes:      []sceneBox{smallBox(r3.Vector{X: 50, Y: 50}), smallBox(r3.Vector{X: 300, Y: 300})},
+		toSensor:   newGroundFrame(normal).toSensor,
+	}
+	return s.cloud(t), s.centers()
+}
+
+// smallBox returns a box of 30 x 30 x 80 mm with a point every 5 mm across and 10 mm up, from 20 mm above the
+// ground, whose corner is at corner.
+func smallBox(corner r3.Vector) sceneBox {
+	return sceneBox{
+		min:  r3.Vector{X: corner.X, Y: corner.Y, Z: 20},
+		max:  r3.Vector{X: corner.X + 30, Y: corner.Y + 30, Z: 100},
+		step: r3.Vector{X: 5, Y: 5, Z: 10},
+	}
+}
+
+func TestGroundFrame(t *testing.T) {
+	up := r3.Vector{X: 0, Y: 0, Z: 1}
+	p := r3.Vector{X: 12, Y: -3, Z: 40}
+	for _, normal := range []r3.Vector{
+		{X: 0, Y: 0, Z: 1},
+		{X: 0, Y: 0, Z: -1},
+		{X: 0, Y: -1, Z: 0},
+		{X: 0, Y: -0.7, Z: 0.7},
+		{X: 0.3, Y: 0.2, Z: -0.9},
+		{X: 1, Y: 0, Z: 0},
+		{X: -0.9, Y: 0.1, Z: 0.2},
+	} {
+		ground := newGroundFrame(normal)
+		test.That(t, ground.fromSensor(normal.Normalize()).Distance(up), test.ShouldBeLessThan, 1e-9)
+		test.That(t, ground.toSensor(ground.fromSensor(p)).Distance(p), test.ShouldBeLessThan, 1e-9)
+	}
+
+	// a small change of the normal only turns the axes a little
+	a := newGroundFrame(r3.Vector{X: 0, Y: -0.7, Z: 0.7001})
+	b := newGroundFrame(r3.Vector{X: 0, Y: -0.7001, Z: 0.7})
+	test.That(t, a.x.Dot(b.x), test.ShouldBeGreaterThan, 0.999)
+	test.That(t, a.y.Dot(b.y), test.ShouldBeGreaterThan, 0.999)
+}
+
+func TestERCCLTiltedGround(t *testing.T) {
+	normal := r3.Vector{X: 0, Y: -0.7, Z: 0.7}
+	cloud, centers := tiltedScene(t, normal)
+	cfg := &ErCCLConfig{
+		MinPtsInPlane:        500,
+		MinPtsInSegment:      20,
+		MaxDistFromPlane:     5,
+		NormalVec:            normal,
+		AngleTolerance:       30,
+		ClusteringRadius:     10,
+		ClusteringStrictness: 1,
+	}
+	cfg.SetDefaultValues()
+	test.That(t, cfg.NormalVec.IsUnit(), test.ShouldBeTrue)
+
+	objects, err := ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 2)
+	// objects come back in the sensor frame
+	for _, center := range centers {
+		found := false
+		for _, obj := range objects {
+			if obj.Geometry.Pose().Point().Distance(center) < 1 {
+				found = true
+			}
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+}
+
+func TestERCCLCancelled(t *testing.T) {
+	cloud, _ := tiltedScene(t, r3.Vector{X: 0, Y: 0, Z: 1})
+	cfg := &ErCCLConfig{MaxDistFromPlane: 5, ClusteringRadius: 10}
+	cfg.SetDefaultValues()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ApplyERCCLToPointCloud(ctx, cloud, cfg)
+	test.That(t, err, test.ShouldBeError, context.Canceled)
+	_, err = pcProjection(ctx, cloud, 10)
+	test.That(t, err, test.ShouldBeError, context.Canceled)
+	labelMap := randomLabelMap(50, 50, 0.5, 0)
+	err = LabelMapUpdate(ctx, labelMap, 3, 0.9, 1, 1, 4, NeighborhoodSquare)
+	test.That(t, err, test.ShouldBeError, context.Canceled)
+}
+
+func TestERCCLProcessingBudget(t *testing.T) {
+	// a dense and noisy ground so the full ground plane search takes much longer than the budget
+	cloud := scene{
+		groundMax:  r3.Vector{X: 2000, Y: 2000},
+		groundStep: 10,
+		boxes:      []sceneBox{smallBox(r3.Vector{X: 500, Y: 500}), smallBox(r3.Vector{X: 1500, Y: 1500})},
+		noise:      1,
+	}.cloud(t)
+	cfg := &ErCCLConfig{MinPtsInSegment: 20, MaxDistFromPlane: 5, ClusteringRadius: 10, MaxProcessingTime: 1}
+	cfg.SetDefaultValues()
+	res, err := segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.degraded, test.ShouldBeTrue)
+	// the objects depend on how far the ground plane search got, but there are some
+	test.That(t, len(res.objects), test.ShouldBeGreaterThan, 0)
+	for _, obj := range res.objects {
+		test.That(t, obj.Geometry.Label(), test.ShouldEqual, DegradedLabel)
+	}
+
+	// without a budget nothing is degraded
+	cfg.MaxProcessingTime = 0
+	res, err = segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.degraded, test.ShouldBeFalse)
+	test.That(t, len(res.objects), test.ShouldEqual, 2)
+	for _, obj := range res.objects {
+		test.That(t, obj.Geometry.Label(), test.ShouldEqual, "")
+	}
+}
+
+func TestGridResolution(t *testing.T) {
+	meta := pc.NewMetaData()
+	meta.Merge(r3.Vector{X: 0, Y: 0, Z: 0}, nil)
+	meta.Merge(r3.Vector{X: 30000, Y: 10000, Z: 500}, nil)
+
+	cfg := &ErCCLConfig{}
+	cfg.SetDefaultValues()
+	test.That(t, cfg.ClusteringAlpha, test.ShouldEqual, ClusteringAlphaDefault)
+	test.That(t, cfg.GridCells, test.ShouldEqual, GridSize)
+	// (150 + 50) / 2
+	test.That(t, gridResolution(meta, cfg), test.ShouldEqual, 100)
+
+	cfg.GridCells = 1000
+	test.That(t, gridResolution(meta, cfg), test.ShouldEqual, 20)
+
+	cfg.GridResolution = 25
+	test.That(t, gridResolution(meta, cfg), test.ShouldEqual, 25)
+
+	// a single point has no extent
+	cfg.GridResolution = 0
+	point := pc.NewMetaData()
+	point.Merge(r3.Vector{X: 800, Y: 800, Z: 100}, nil)
+	test.That(t, gridResolution(point, cfg), test.ShouldEqual, 1)
+}
+
+func TestERCCLSinglePointAboveGround(t *testing.T) {
+	cloud := scene{
+		groundMin:  r3.Vector{X: -1000, Y: -1000},
+		groundMax:  r3.Vector{X: 1020, Y: 1020},
+		groundStep: 20,
+	}.cloud(t)
+	test.That(t, cloud.Set(r3.Vector{X: 800, Y: 800, Z: 100}, pc.NewBasicData()), test.ShouldBeNil)
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MinPtsInSegment: 1, MaxDistFromPlane: 20}
+	cfg.SetDefaultValues()
+	objects, err := ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+}
+
+// iterativeLabelMapUpdate is the previous ER-CCL labeler, which repeats a minimum label search over the whole
+// grid until nothing changes. It is kept as a reference for the disjoint-set labeler.
+func iterativeLabelMapUpdate(labelMap [][]node, r int, alpha, beta, s float64) {
+	for {
+		mapChanged := false
+		for i, curNodeSlice := range labelMap {
+			for j, curNode := range curNodeSlice {
+				if curNode.label == -1 {
+					continue
+				}
+				minLabel := curNode.label
+				neighbors := make([]node, 0)
+				for x := 0; x < r && i+x < len(labelMap); x++ {
+					for y := 0; y < r && j+y < len(curNodeSlice); y++ {
+						if x == 0 && y == 0 {
+							continue
+						}
+						neighborNode := labelMap[i+x][j+y]
+						if similarEnough(curNode, neighborNode, r, alpha, beta, s) {
+							neighbors = append(neighbors, neighborNode)
+							minLabel = int(math.Min(float64(minLabel), float64(neighborNode.label)))
+						}
+					}
+				}
+				if minLabel != curNode.label {
+					mapChanged = true
+					labelMap[curNode.i][curNode.j].label = minLabel
+				}
+				for _, neighbor := range neighbors {
+					if neighbor.label != minLabel {
+						mapChanged = true
+						labelMap[neighbor.i][neighbor.j].label = minLabel
+					}
+				}
+			}
+		}
+		if !mapChanged {
+			return
+		}
+	}
+}
+
+// randomLabelMap returns an h x w label map where each cell is occupied with the given probability.
+func randomLabelMap(h, w int, occupancy float64, seed int64) [][]node {
+	//nolint:gosec
+	rnd := rand.New(rand.NewSource(seed))
+	labelMap := make([][]node, h)
+	for i := range labelMap {
+		labelMap[i] = make([]node, w)
+		for j := range labelMap[i] {
+			labelMap[i][j] = node{i: i, j: j, label: -1}
+			if rnd.Float64() < occupancy {
+				labelMap[i][j].label = i*w + j
+				labelMap[i][j].maxHeight = 10 * rnd.Float64()
+			}
+		}
+	}
+	return labelMap
+}
+
+// fenceLabelMap returns an h x w label map with a single fence snaking up and down the grid, every second
+// column. This is the worst case for the iterative labeler, which needs one pass per cell going up.
+func fenceLabelMap(h, w int) [][]node {
+	labelMap := randomLabelMap(h, w, 0, 0)
+	occupy := func(i, j int) {
+		labelMap[i][j].label = i*w + j
+	}
+	for j := 0; j < w; j += 2 {
+		for i := 0; i < h; i++ {
+			occupy(i, j)
+		}
+		if j+1 < w {
+			// join to the next column at the bottom or at the top
+			if (j/2)%2 == 0 {
+				occupy(h-1, j+1)
+			} else {
+				occupy(0, j+1)
+			}
+		}
+	}
+	return labelMap
+}
+
+func copyLabelMap(labelMap [][]node) [][]node {
+	out := make([][]node, len(labelMap))
+	for i := range labelMap {
+		out[i] = append([]node(nil), labelMap[i]...)
+	}
+	return out
+}
+
+func TestLabelMapUpdateMatchesIterative(t *testing.T) {
+	for seed, occupancy := range []float64{0.05, 0.2, 0.5, 0.9} {
+		for _, r := range []int{1, 2, 5} {
+			labelMap := randomLabelMap(60, 80, occupancy, int64(seed))
+			expected := copyLabelMap(labelMap)
+			iterativeLabelMapUpdate(expected, r, 0.9, 1, 1)
+			test.That(t, LabelMapUpdate(context.Background(), labelMap, r, 0.9, 1, 1, 1, NeighborhoodQuadrant), test.ShouldBeNil)
+			test.That(t, labelMap, test.ShouldResemble, expected)
+		}
+	}
+	labelMap := fenceLabelMap(40, 40)
+	expected := copyLabelMap(labelMap)
+	iterativeLabelMapUpdate(expected, 2, 0.9, 1, 1)
+	test.That(t, LabelMapUpdate(context.Background(), labelMap, 2, 0.9, 1, 1, 1, NeighborhoodQuadrant), test.ShouldBeNil)
+	test.That(t, labelMap, test.ShouldResemble, expected)
+	// the whole fence is a single cluster
+	test.That(t, countClusters(labelMap), test.ShouldEqual, 1)
+}
+
+func TestLabelMapUpdateParallel(t *testing.T) {
+	for seed, occupancy := range []float64{0.05, 0.3, 0.7} {
+		for _, r := range []int{1, 3, 6} {
+			labelMap := randomLabelMap(97, 50, occupancy, int64(seed))
+			expected := copyLabelMap(labelMap)
+			test.That(t, LabelMapUpdate(context.Background(), expected, r, 0.9, 1, 1, 1, NeighborhoodQuadrant), test.ShouldBeNil)
+			// includes strips thinner than the search radius and more workers than rows
+			for _, workers := range []int{2, 3, 8, 40, 200} {
+				parallel := copyLabelMap(labelMap)
+				test.That(t, LabelMapUpdate(context.Background(), parallel, r, 0.9, 1, 1, workers, NeighborhoodQuadrant), test.ShouldBeNil)
+				test.That(t, parallel, test.ShouldResemble, expected)
+			}
+		}
+	}
+	labelMap := fenceLabelMap(64, 64)
+	expected := copyLabelMap(labelMap)
+	test.That(t, LabelMapUpdate(context.Background(), expected, 2, 0.9, 1, 1, 1, NeighborhoodQuadrant), test.ShouldBeNil)
+	parallel := copyLabelMap(labelMap)
+	test.That(t, LabelMapUpdate(context.Background(), parallel, 2, 0.9, 1, 1, 7, NeighborhoodQuadrant), test.ShouldBeNil)
+	test.That(t, parallel, test.ShouldResemble, expected)
+}
+
+// shapeLabelMap returns an h x w label map with only the given cells occupied.
+func shapeLabelMap(h, w int, cells []offset) [][]node {
+	labelMap := randomLabelMap(h, w, 0, 0)
+	for _, c := range cells {
+		labelMap[c.di][c.dj].label = c.di*w + c.dj
+	}
+	return labelMap
+}
+
+func countClusters(labelMap [][]node) int {
+	labels := make(map[int]bool)
+	for _, row := range labelMap {
+		for _, n := range row {
+			if n.label != -1 {
+				labels[n.label] = true
+			}
+		}
+	}
+	return len(labels)
+}
+
+func TestLabelMapUpdateNeighborhood(t *testing.T) {
+	// an L whose foot goes left, touching the bottom of its stroke diagonally
+	lShape := make([]offset, 0)
+	for i := 0; i < 10; i++ {
+		lShape = append(lShape, offset{di: i, dj: 9})
+	}
+	for j := 0; j < 9; j++ {
+		lShape = append(lShape, offset{di: 10, dj: j})
+	}
+	// a V made of two diagonal arms
+	vShape := make([]offset, 0)
+	for i := 0; i < 6; i++ {
+		vShape = append(vShape, offset{di: i, dj: i}, offset{di: i, dj: 10 - i})
+	}
+	for name, cells := range map[string][]offset{"L": lShape, "V": vShape} {
+		t.Run(name, func(t *testing.T) {
+			labelMap := shapeLabelMap(12, 12, cells)
+			quadrant := copyLabelMap(labelMap)
+			test.That(t, LabelMapUpdate(context.Background(), quadrant, 2, 0.9, 1, 1, 1, NeighborhoodQuadrant), test.ShouldBeNil)
+			test.That(t, countClusters(quadrant), test.ShouldBeGreaterThan, 1)
+			for _, shape := range []Neighborhood{NeighborhoodSquare, NeighborhoodDisk} {
+				full := copyLabelMap(labelMap)
+				test.That(t, LabelMapUpdate(context.Background(), full, 2, 0.9, 1, 1, 1, shape), test.ShouldBeNil)
+				test.That(t, countClusters(full), test.ShouldEqual, 1)
+			}
+		})
+	}
+
+	// the disk leaves out the corners of the square
+	corner := shapeLabelMap(5, 5, []offset{{di: 0, dj: 0}, {di: 3, dj: 3}})
+	test.That(t, LabelMapUpdate(context.Background(), corner, 4, 0.9, 1, 1, 1, NeighborhoodDisk), test.ShouldBeNil)
+	test.That(t, countClusters(corner), test.ShouldEqual, 2)
+	corner = shapeLabelMap(5, 5, []offset{{di: 0, dj: 0}, {di: 3, dj: 3}})
+	test.That(t, LabelMapUpdate(context.Background(), corner, 4, 0.9, 1, 1, 1, NeighborhoodSquare), test.ShouldBeNil)
+	test.That(t, countClusters(corner), test.ShouldEqual, 1)
+
+	// the full neighborhoods give the same result on any number of workers
+	labelMap := randomLabelMap(80, 40, 0.2, 3)
+	for _, shape := range []Neighborhood{NeighborhoodSquare, NeighborhoodDisk} {
+		expected := copyLabelMap(labelMap)
+		test.That(t, LabelMapUpdate(context.Background(), expected, 4, 0.9, 1, 1, 1, shape), test.ShouldBeNil)
+		for _, workers := range []int{2, 5, 30} {
+			parallel := copyLabelMap(labelMap)
+			test.That(t, LabelMapUpdate(context.Background(), parallel, 4, 0.9, 1, 1, workers, shape), test.ShouldBeNil)
+			test.That(t, parallel, test.ShouldResemble, expected)
+		}
+	}
+
+	err := LabelMapUpdate(context.Background(), labelMap, 4, 0.9, 1, 1, 1, "hexagon")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "unknown clustering neighborhood")
+}
+
+func benchmarkLabeler(b *testing.B, labelMap [][]node, labeler func([][]node)) {
+	b.Helper()
+	for b.Loop() {
+		labeler(copyLabelMap(labelMap))
+	}
+}
+
+func BenchmarkLabelMapUpdate(b *testing.B) {
+	disjointSet := func(labelMap [][]node) {
+		//nolint:errcheck
+		LabelMapUpdate(context.Background(), labelMap, 2, 0.9, 1, 1, 1, NeighborhoodQuadrant)
+	}
+	parallel := func(labelMap [][]node) {
+		//nolint:errcheck
+		LabelMapUpdate(context.Background(), labelMap, 2, 0.9, 1, 1, runtime.NumCPU(), NeighborhoodQuadrant)
+	}
+	iterative := func(labelMap [][]node) {
+		iterativeLabelMapUpdate(labelMap, 2, 0.9, 1, 1)
+	}
+	dense := randomLabelMap(GridSize, GridSize, 0.3, 1)
+	fence := fenceLabelMap(GridSize/2, GridSize/2)
+	b.Run("DisjointSetDense", func(b *testing.B) { benchmarkLabeler(b, dense, disjointSet) })
+	b.Run("ParallelDense", func(b *testing.B) { benchmarkLabeler(b, dense, parallel) })
+	b.Run("IterativeDense", func(b *testing.B) { benchmarkLabeler(b, dense, iterative) })
+	b.Run("DisjointSetFence", func(b *testing.B) { benchmarkLabeler(b, fence, disjointSet) })
+	b.Run("ParallelFence", func(b *testing.B) { benchmarkLabeler(b, fence, parallel) })
+	b.Run("IterativeFence", func(b *testing.B) { benchmarkLabeler(b, fence, iterative) })
+}
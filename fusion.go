@@ -0,0 +1,223 @@
+package obstaclespointcloud
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/vision"
+)
+
+// Default values of the temporal fusion.
+const (
+	FusionHitProbabilityDefault      = 0.7
+	FusionMissProbabilityDefault     = 0.4
+	FusionOccupiedProbabilityDefault = 0.8
+	FusionHalfLifeDefault            = 1000
+	FusionResolutionDefault          = 50.
+	FusionExtentDefault              = 10000.
+	// logOddsLimit keeps the cells from getting so certain that they take many frames to change.
+	logOddsLimit = 5.
+)
+
+// FusionConfig specifies how the ground and obstacle points of each frame are fused over time.
+type FusionConfig struct {
+	// HitProbability is the probability that a cell is occupied when obstacle points are seen in it, and
+	// MissProbability the probability that it is occupied when only ground points are seen in it.
+	HitProbability  float64
+	MissProbability float64
+	// OccupiedProbability is the probability above which a fused cell is part of an obstacle.
+	OccupiedProbability float64
+	// HalfLife is the time in ms it takes for what is known about a cell to be halved.
+	HalfLife int
+	// Resolution is the size of the cells in mm, and Extent the length of the sides of the grid in mm.
+	Resolution float64
+	Extent     float64
+	// Anchored is true when the point clouds are in a fixed frame, so the grid stays where the sensor was at the
+	// first frame. Otherwise the grid moves with the sensor, and the fusion assumes the sensor does not move.
+	Anchored bool
+}
+
+// SetDefaultValues sets the default values for the FusionConfig.
+func (cfg *FusionConfig) SetDefaultValues() {
+	if cfg.HitProbability <= 0.5 || cfg.HitProbability >= 1 {
+		cfg.HitProbability = FusionHitProbabilityDefault
+	}
+	if cfg.MissProbability <= 0 || cfg.MissProbability >= 0.5 {
+		cfg.MissProbability = FusionMissProbabilityDefault
+	}
+	if cfg.OccupiedProbability <= 0 || cfg.OccupiedProbability >= 1 {
+		cfg.OccupiedProbability = FusionOccupiedProbabilityDefault
+	}
+	if cfg.HalfLife <= 0 {
+		cfg.HalfLife = FusionHalfLifeDefault
+	}
+	if cfg.Resolution <= 0 {
+		cfg.Resolution = FusionResolutionDefault
+	}
+	if cfg.Extent <= 0 {
+		cfg.Extent = FusionExtentDefault
+	}
+}
+
+// logit returns the log-odds of a probability.
+func logit(p float64) float64 {
+	return math.Log(p / (1 - p))
+}
+
+// fusionGrid is an occupancy grid on the ground plane that holds the log-odds of each cell being occupied,
+// fused over the frames. Obstacles are the groups of touching cells that are likely enough to be occupied.
+type fusionGrid struct {
+	mu  sync.Mutex
+	cfg FusionConfig
+	// logOdds of each cell, 0 is unknown
+	logOdds []float64
+	// minHeight and maxHeight are the heights of the obstacle points last seen in each cell, and seen their number
+	minHeight, maxHeight []float64
+	seen                 []int
+	last                 time.Time
+	// anchor is the ground frame of the first frame, nil until then or if the grid is not anchored
+	anchor *groundFrame
+	// axis is the X axis of the ground frame of the first frame, zero until then
+	axis r3.Vector
+}
+
+// newFusionGrid returns a grid where nothing is known yet.
+func newFusionGrid(cfg FusionConfig) *fusionGrid {
+	cfg.SetDefaultValues()
+	return &fusionGrid{cfg: cfg}
+}
+
+// groundFrame returns the ground frame of the grid for a frame whose ground frame is ground. The cells of a grid
+// that moves with the sensor are only the same places across frames if it stays still, and if they keep the X
+// axis of the first frame when the normal found changes a little.
+func (f *fusionGrid) groundFrame(ground groundFrame) groundFrame {
+	if f.axis.Norm2() == 0 {
+		f.axis = ground.x
+	}
+	kept := newGroundFrameAlong(ground.normal, f.axis)
+	kept.origin = ground.origin
+	if f.cfg.Anchored {
+		if f.anchor == nil {
+			f.anchor = &kept
+		}
+		return *f.anchor
+	}
+	return kept
+}
+
+// update fuses the ground and obstacle points of a run of the ER-CCL pipeline into the grid, and returns the
+// obstacles of the fused grid, followed by the negative obstacles of the frame. Each obstacle has the points of the
+// frame that fall in its cells, with their data, and the cells where it was not seen this frame are filled with
+// points at the heights it was last seen at.
+func (f *fusionGrid) update(res *erCCLResult, now time.Time, cfg *ErCCLConfig) ([]*vision.Object, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ground := f.groundFrame(res.ground)
+	groundHeight := 0.
+	if res.plane != nil {
+		groundHeight = ground.fromSensor(res.plane.Center()).Z
+	}
+	frame, err := newOccupancyGrid(ground, groundHeight, f.cfg.Resolution, f.cfg.Extent)
+	if err != nil {
+		return nil, err
+	}
+	if res.plane != nil {
+		planeCloud, err := res.plane.PointCloud()
+		if err != nil {
+			return nil, err
+		}
+		frame.mark(planeCloud, OccupancyFree)
+	}
+	// every obstacle point of the frame is a hit, the components of the fused grid are pruned by the number of
+	// points last seen in their cells
+	framePoints := make(map[int][]r3.Vector)
+	frameData := make(map[int][]pc.Data)
+	if res.obstaclePoints != nil {
+		frame.mark(res.obstaclePoints, OccupancyOccupied)
+		res.obstaclePoints.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+			if i, ok := frame.cell(p); ok {
+				framePoints[i] = append(framePoints[i], p)
+				frameData[i] = append(frameData[i], d)
+			}
+			return true
+		})
+	}
+
+	if f.logOdds == nil {
+		f.logOdds = make([]float64, len(frame.cells))
+		f.minHeight = make([]float64, len(frame.cells))
+		f.maxHeight = make([]float64, len(frame.cells))
+		f.seen = make([]int, len(frame.cells))
+	}
+	decay := 1.
+	if !f.last.IsZero() {
+		decay = math.Pow(0.5, float64(now.Sub(f.last).Milliseconds())/float64(f.cfg.HalfLife))
+	}
+	f.last = now
+	hit, miss := logit(f.cfg.HitProbability), logit(f.cfg.MissProbability)
+	for i, state := range frame.cells {
+		f.logOdds[i] *= decay
+		switch state {
+		case OccupancyOccupied:
+			f.logOdds[i] = math.Min(logOddsLimit, f.logOdds[i]+hit)
+			f.minHeight[i], f.maxHeight[i] = math.Inf(1), math.Inf(-1)
+			f.seen[i] = len(framePoints[i])
+			for _, p := range framePoints[i] {
+				h := ground.fromSensor(p).Z
+				f.minHeight[i], f.maxHeight[i] = math.Min(f.minHeight[i], h), math.Max(f.maxHeight[i], h)
+			}
+		case OccupancyFree:
+			f.logOdds[i] = math.Max(-logOddsLimit, f.logOdds[i]+miss)
+		default:
+		}
+	}
+
+	label := ""
+	if res.degraded {
+		label = DegradedLabel
+	}
+	occupied := logit(f.cfg.OccupiedProbability)
+	objects := []*vision.Object{}
+	for _, component := range gridComponents(frame.side, func(i int) bool { return f.logOdds[i] > occupied }) {
+		cloud := pc.NewBasicEmpty()
+		seen := 0
+		for _, i := range component {
+			seen += f.seen[i]
+			points, data := framePoints[i], frameData[i]
+			if len(points) == 0 {
+				// not seen this frame, use the center of the cell at the heights it was last seen at
+				x, y := frame.cellCenter(i)
+				points = []r3.Vector{
+					ground.toSensor(r3.Vector{X: x, Y: y, Z: f.minHeight[i]}),
+					ground.toSensor(r3.Vector{X: x, Y: y, Z: f.maxHeight[i]}),
+				}
+				data = []pc.Data{pc.NewBasicData(), pc.NewBasicData()}
+			}
+			for k, p := range points {
+				if err := cloud.Set(p, data[k]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		// the same pruning as the objects of a frame, so that a stray hit that outlives the decay is not an obstacle
+		minPts := cfg.MinPtsInSegment
+		if len(cfg.RangeAdaptiveClustering) > 0 {
+			minPts = cfg.RangeAdaptiveClustering.minPoints(pc.CloudCentroid(cloud), res.ground)
+		}
+		if seen < minPts {
+			continue
+		}
+		geometry, err := obstacleGeometry(cloud, res.ground, cfg.ObstacleGeometry, label)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, &vision.Object{PointCloud: cloud, Geometry: geometry})
+	}
+	// the drops are not fused, they are found again in every frame
+	return append(objects, res.negatives...), nil
+}
@@ -0,0 +1,184 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/vision"
+)
+
+// flickerScene builds a cloud of a flat ground, with an obstacle on it if withObstacle is set. If occluded is set,
+// the ground where the obstacle stands is missing, as it is for a camera when the obstacle is in front of it.
+func flickerScene(t *testing.T, withObstacle, occluded bool) pc.PointCloud {
+	t.Helper()
+	s := scene{groundMax: r3.Vector{X: 1000, Y: 1000}, groundStep: 10}
+	if occluded {
+		s.hole = func(x, y float64) bool {
+			return x >= 390 && x <= 470 && y >= 390 && y <= 470
+		}
+	}
+	if withObstacle {
+		s.boxes = []sceneBox{{
+			min:  r3.Vector{X: 400, Y: 400, Z: 50},
+			max:  r3.Vector{X: 460, Y: 460, Z: 200},
+			step: r3.Vector{X: 10, Y: 10, Z: 10},
+		}}
+	}
+	return s.cloud(t)
+}
+
+func TestFusionGrid(t *testing.T) {
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MinPtsInSegment: 20, MaxDistFromPlane: 5, ClusteringRadius: 5}
+	cfg.SetDefaultValues()
+	fusion := newFusionGrid(FusionConfig{Resolution: 50, Extent: 4000})
+	start := time.Unix(0, 0)
+	step := func(k int, withObstacle, occluded bool) int {
+		res, err := segmentERCCL(context.Background(), flickerScene(t, withObstacle, occluded), r3.Vector{}, cfg, nil)
+		test.That(t, err, test.ShouldBeNil)
+		objects, err := fusion.update(res, start.Add(time.Duration(k)*100*time.Millisecond), cfg)
+		test.That(t, err, test.ShouldBeNil)
+		for _, obj := range objects {
+			// the obstacle keeps its place and height
+			center := obj.Geometry.Pose().Point()
+			test.That(t, center.X, test.ShouldAlmostEqual, 430, 30)
+			test.That(t, center.Y, test.ShouldAlmostEqual, 430, 30)
+			test.That(t, center.Z, test.ShouldAlmostEqual, 125, 1)
+		}
+		return len(objects)
+	}
+
+	// one frame is not enough to be sure of the obstacle
+	test.That(t, step(0, true, true), test.ShouldEqual, 0)
+	test.That(t, step(1, true, true), test.ShouldEqual, 1)
+	// the obstacle flickers out of a frame, but is still there
+	test.That(t, step(2, false, true), test.ShouldEqual, 1)
+	test.That(t, step(3, true, true), test.ShouldEqual, 1)
+	// the obstacle is gone, the ground under it can be seen, which takes more than a frame to be sure of
+	test.That(t, step(4, false, false), test.ShouldEqual, 1)
+	test.That(t, step(5, false, false), test.ShouldEqual, 0)
+	test.That(t, step(6, false, false), test.ShouldEqual, 0)
+
+	// what was known fades away over time, so after a while the obstacle has to be seen twice again
+	test.That(t, step(30, true, true), test.ShouldEqual, 0)
+	test.That(t, step(31, true, true), test.ShouldEqual, 1)
+	// and it is forgotten if it is not seen for long
+	test.That(t, step(32, false, true), test.ShouldEqual, 1)
+	test.That(t, step(60, false, true), test.ShouldEqual, 0)
+}
+
+func TestFusionGridPrunesSmallObstacles(t *testing.T) {
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MinPtsInSegment: 20, MaxDistFromPlane: 5, ClusteringRadius: 5}
+	cfg.SetDefaultValues()
+	fusion := newFusionGrid(FusionConfig{Resolution: 50, Extent: 4000})
+	// a noisy point above the ground is seen in every frame, it is a hit in the fused grid but not an obstacle
+	cloud := flickerScene(t, false, false)
+	test.That(t, cloud.Set(r3.Vector{X: 800, Y: 800, Z: 100}, pc.NewBasicData()), test.ShouldBeNil)
+	for k := range 5 {
+		res, err := segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+		test.That(t, err, test.ShouldBeNil)
+		objects, err := fusion.update(res, time.Unix(0, 0).Add(time.Duration(k)*100*time.Millisecond), cfg)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(objects), test.ShouldEqual, 0)
+	}
+}
+
+func TestFusionGridAnchored(t *testing.T) {
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MinPtsInSegment: 20, MaxDistFromPlane: 5, ClusteringRadius: 5}
+	cfg.SetDefaultValues()
+	// the sensor drives by the obstacle, whose points are in a fixed frame
+	run := func(anchored bool) []int {
+		fusion := newFusionGrid(FusionConfig{Resolution: 50, Extent: 4000, Anchored: anchored})
+		counts := []int{}
+		for k := range 3 {
+			sensor := r3.Vector{X: float64(k) * 1000, Z: 1000}
+			res, err := segmentERCCL(context.Background(), flickerScene(t, true, true), sensor, cfg, nil)
+			test.That(t, err, test.ShouldBeNil)
+			objects, err := fusion.update(res, time.Unix(0, 0).Add(time.Duration(k)*100*time.Millisecond), cfg)
+			test.That(t, err, test.ShouldBeNil)
+			for _, obj := range objects {
+				center := obj.Geometry.Pose().Point()
+				test.That(t, center.X, test.ShouldAlmostEqual, 430, 30)
+				test.That(t, center.Y, test.ShouldAlmostEqual, 430, 30)
+			}
+			counts = append(counts, len(objects))
+		}
+		return counts
+	}
+	test.That(t, run(true), test.ShouldResemble, []int{0, 1, 1})
+	// a grid that moves with the sensor puts the obstacle in another cell each frame
+	test.That(t, run(false), test.ShouldResemble, []int{0, 0, 0})
+}
+
+func TestFusionGridNegativesAndData(t *testing.T) {
+	// the points of the box are red
+	red := color.NRGBA{255, 0, 0, 255}
+	cloud := pc.NewBasicEmpty()
+	warehouseScene(t).Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		if p.Z > -490 {
+			d = pc.NewColoredData(red)
+		}
+		test.That(t, cloud.Set(p, d), test.ShouldBeNil)
+		return true
+	})
+	cfg := &ErCCLConfig{
+		MinPtsInPlane:     500,
+		MinPtsInSegment:   20,
+		MaxDistFromPlane:  5,
+		ClusteringRadius:  5,
+		GridResolution:    20,
+		NegativeObstacles: true,
+	}
+	cfg.SetDefaultValues()
+	fusion := newFusionGrid(FusionConfig{Resolution: 50, Extent: 4000})
+	var objects []*vision.Object
+	for k := range 2 {
+		res, err := segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+		test.That(t, err, test.ShouldBeNil)
+		objects, err = fusion.update(res, time.Unix(0, 0).Add(time.Duration(k)*100*time.Millisecond), cfg)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	// the box, the drain and the drop
+	test.That(t, objects, test.ShouldHaveLength, 3)
+	negatives := 0
+	for _, obj := range objects {
+		if obj.Geometry.Label() == NegativeObstacleLabel {
+			negatives++
+			continue
+		}
+		obj.PointCloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+			test.That(t, d.HasColor(), test.ShouldBeTrue)
+			test.That(t, d.Color(), test.ShouldResemble, &red)
+			return true
+		})
+	}
+	test.That(t, negatives, test.ShouldEqual, 2)
+}
+
+func TestFusionConfigDefaults(t *testing.T) {
+	cfg := FusionConfig{HitProbability: 0.3, MissProbability: 0.6}
+	cfg.SetDefaultValues()
+	test.That(t, cfg.HitProbability, test.ShouldEqual, FusionHitProbabilityDefault)
+	test.That(t, cfg.MissProbability, test.ShouldEqual, FusionMissProbabilityDefault)
+	test.That(t, cfg.HalfLife, test.ShouldEqual, FusionHalfLifeDefault)
+	test.That(t, logit(0.5), test.ShouldEqual, 0)
+}
+
+func TestFusionGridKeepsAxes(t *testing.T) {
+	// near 45 degrees from the X axis of the sensor, a little noise moves the X axis of the ground frame a lot
+	first := newGroundFrame(r3.Vector{X: 0.7, Y: 0.7001})
+	second := newGroundFrame(r3.Vector{X: 0.7001, Y: 0.7})
+	test.That(t, first.x.Dot(second.x), test.ShouldBeLessThan, 0.9)
+
+	fusion := newFusionGrid(FusionConfig{})
+	test.That(t, fusion.groundFrame(first).x.Distance(first.x), test.ShouldBeLessThan, 1e-9)
+	kept := fusion.groundFrame(second)
+	test.That(t, kept.x.Dot(first.x), test.ShouldBeGreaterThan, 0.999)
+	test.That(t, kept.normal.Distance(second.normal), test.ShouldBeLessThan, 1e-9)
+	test.That(t, kept.x.Dot(kept.normal), test.ShouldAlmostEqual, 0, 1e-9)
+}
@@ -0,0 +1,446 @@
+package obstaclespointcloud
+
+import (
+	"math"
+	"sort"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// ObstacleGeometry is the kind of geometry returned for each obstacle.
+type ObstacleGeometry string
+
+// The obstacle geometries. A box is aligned with the axes of the point cloud's frame. An oriented bounding box
+// (obb) is the box with the smallest footprint on the ground that fits the obstacle, it only rotates about the
+// ground normal. A hull prism is the convex hull of the footprint of the obstacle on the ground, extruded along
+// the ground normal, and a mesh is the 3D convex hull of its points. The sphere and the capsule enclose the
+// obstacle, the capsule standing along the ground normal.
+const (
+	GeometryBox       ObstacleGeometry = "box"
+	GeometryOBB       ObstacleGeometry = "obb"
+	GeometryHullPrism ObstacleGeometry = "hull_prism"
+	GeometryMesh      ObstacleGeometry = "mesh"
+	GeometrySphere    ObstacleGeometry = "sphere"
+	GeometryCapsule   ObstacleGeometry = "capsule"
+)
+
+// obstacleGeometry returns the geometry of the given kind around the points of an obstacle.
+// When the points are too degenerate for the kind, such as a flat obstacle for a mesh or a single point for
+// a sphere, the oriented bounding box is returned instead.
+func obstacleGeometry(cloud pc.PointCloud, ground groundFrame, kind ObstacleGeometry, label string) (spatialmath.Geometry, error) {
+	var geometry spatialmath.Geometry
+	var err error
+	switch kind {
+	case GeometryBox, "":
+		return pc.BoundingBoxFromPointCloudWithLabel(cloud, label)
+	case GeometryOBB:
+		return orientedBoundingBox(cloud, ground, label)
+	case GeometryHullPrism:
+		geometry, err = hullPrism(cloud, ground, label)
+	case GeometryMesh:
+		geometry, err = hullMesh(cloud, ground, label)
+	case GeometrySphere:
+		geometry, err = boundingSphere(cloud, ground, label)
+	case GeometryCapsule:
+		geometry, err = boundingCapsule(cloud, ground, label)
+	default:
+		return nil, errors.Errorf("unknown obstacle geometry %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if geometry == nil {
+		return orientedBoundingBox(cloud, ground, label)
+	}
+	return geometry, nil
+}
+
+// orientedBoundingBox returns the box around the points that has the smallest footprint on the ground,
+// and whose height is along the ground normal.
+func orientedBoundingBox(cloud pc.PointCloud, ground groundFrame, label string) (spatialmath.Geometry, error) {
+	footprint, minHeight, maxHeight := groundFootprint(cloud, ground)
+	angle, minCorner, maxCorner := minAreaRectangle(convexHull2D(footprint))
+	axisX := r2.Point{X: math.Cos(angle), Y: math.Sin(angle)}
+	axisY := axisX.Ortho()
+	// center of the rectangle, back in the ground frame
+	center := axisX.Mul((minCorner.X + maxCorner.X) / 2).Add(axisY.Mul((minCorner.Y + maxCorner.Y) / 2))
+	orientation, err := ground.orientation(angle)
+	if err != nil {
+		return nil, err
+	}
+	pose := spatialmath.NewPose(ground.toSensor(r3.Vector{X: center.X, Y: center.Y, Z: (minHeight + maxHeight) / 2}), orientation)
+	dims := r3.Vector{X: maxCorner.X - minCorner.X, Y: maxCorner.Y - minCorner.Y, Z: maxHeight - minHeight}
+	return spatialmath.NewBox(pose, dims, label)
+}
+
+// hullPrism returns the convex hull of the footprint of the points on the ground, extruded along the ground normal
+// over the heights of the points, as a mesh. It returns nil if the footprint has no area, or the points no height.
+func hullPrism(cloud pc.PointCloud, ground groundFrame, label string) (spatialmath.Geometry, error) {
+	footprint, minHeight, maxHeight := groundFootprint(cloud, ground)
+	// the heights of the points of a flat obstacle differ by the rounding of the ground frame
+	if maxHeight-minHeight <= 1e-9*math.Max(math.Max(math.Abs(minHeight), math.Abs(maxHeight)), 1) {
+		return nil, nil
+	}
+	hull := convexHull2D(footprint)
+	if len(hull) < 3 {
+		return nil, nil
+	}
+	var center r2.Point
+	for _, p := range hull {
+		center = center.Add(p)
+	}
+	center = center.Mul(1 / float64(len(hull)))
+	height := (maxHeight - minHeight) / 2
+	bottom := func(i int) r3.Vector {
+		return r3.Vector{X: hull[i].X - center.X, Y: hull[i].Y - center.Y, Z: -height}
+	}
+	top := func(i int) r3.Vector {
+		return r3.Vector{X: hull[i].X - center.X, Y: hull[i].Y - center.Y, Z: height}
+	}
+	// the hull is counter clockwise seen from above, so the triangles below face outward
+	triangles := make([]*spatialmath.Triangle, 0, 4*len(hull)-4)
+	for i := 1; i < len(hull)-1; i++ {
+		triangles = append(triangles,
+			spatialmath.NewTriangle(bottom(0), bottom(i+1), bottom(i)),
+			spatialmath.NewTriangle(top(0), top(i), top(i+1)))
+	}
+	for i := range hull {
+		next := (i + 1) % len(hull)
+		triangles = append(triangles,
+			spatialmath.NewTriangle(bottom(i), bottom(next), top(next)),
+			spatialmath.NewTriangle(bottom(i), top(next), top(i)))
+	}
+	return groundMesh(ground, r3.Vector{X: center.X, Y: center.Y, Z: (minHeight + maxHeight) / 2}, triangles, label)
+}
+
+// hullMesh returns the 3D convex hull of the points as a mesh. It returns nil if the points are all on a plane.
+func hullMesh(cloud pc.PointCloud, ground groundFrame, label string) (spatialmath.Geometry, error) {
+	points := make([]r3.Vector, 0, cloud.Size())
+	var center r3.Vector
+	cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		g := ground.fromSensor(p)
+		points = append(points, g)
+		center = center.Add(g)
+		return true
+	})
+	center = center.Mul(1 / float64(len(points)))
+	points = hullCandidates(points)
+	faces := convexHull3D(points)
+	if faces == nil {
+		return nil, nil
+	}
+	triangles := make([]*spatialmath.Triangle, 0, len(faces))
+	for _, f := range faces {
+		triangles = append(triangles,
+			spatialmath.NewTriangle(points[f[0]].Sub(center), points[f[1]].Sub(center), points[f[2]].Sub(center)))
+	}
+	return groundMesh(ground, center, triangles, label)
+}
+
+// groundMesh returns a mesh of triangles given in the ground frame, relative to center.
+func groundMesh(ground groundFrame, center r3.Vector, triangles []*spatialmath.Triangle, label string) (spatialmath.Geometry, error) {
+	orientation, err := ground.orientation(0)
+	if err != nil {
+		return nil, err
+	}
+	return spatialmath.NewMesh(spatialmath.NewPose(ground.toSensor(center), orientation), triangles, label), nil
+}
+
+// boundingSphere returns a sphere around the points, centered on their oriented bounding box.
+// It returns nil if all the points are the same.
+func boundingSphere(cloud pc.PointCloud, ground groundFrame, label string) (spatialmath.Geometry, error) {
+	box, err := orientedBoundingBox(cloud, ground, label)
+	if err != nil {
+		return nil, err
+	}
+	center := box.Pose().Point()
+	radius := 0.
+	cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		radius = math.Max(radius, p.Distance(center))
+		return true
+	})
+	if radius == 0 {
+		return nil, nil
+	}
+	return spatialmath.NewSphere(spatialmath.NewPoseFromPoint(center), radius, label)
+}
+
+// boundingCapsule returns a capsule standing along the ground normal around the points, centered on the
+// footprint of their oriented bounding box. It returns nil if the footprint is a single point.
+func boundingCapsule(cloud pc.PointCloud, ground groundFrame, label string) (spatialmath.Geometry, error) {
+	footprint, minHeight, maxHeight := groundFootprint(cloud, ground)
+	angle, minCorner, maxCorner := minAreaRectangle(convexHull2D(footprint))
+	axisX := r2.Point{X: math.Cos(angle), Y: math.Sin(angle)}
+	axisY := axisX.Ortho()
+	center := axisX.Mul((minCorner.X + maxCorner.X) / 2).Add(axisY.Mul((minCorner.Y + maxCorner.Y) / 2))
+	radius := 0.
+	for _, p := range footprint {
+		radius = math.Max(radius, p.Sub(center).Norm())
+	}
+	if radius == 0 {
+		return nil, nil
+	}
+	orientation, err := ground.orientation(0)
+	if err != nil {
+		return nil, err
+	}
+	// the segment of the capsule spans the heights of the points, the caps add the radius at both ends
+	pose := spatialmath.NewPose(ground.toSensor(r3.Vector{X: center.X, Y: center.Y, Z: (minHeight + maxHeight) / 2}), orientation)
+	return spatialmath.NewCapsule(pose, radius, maxHeight-minHeight+2*radius, label)
+}
+
+// groundFootprint returns the points projected on the ground, along with the range of their heights.
+func groundFootprint(cloud pc.PointCloud, ground groundFrame) ([]r2.Point, float64, float64) {
+	footprint := make([]r2.Point, 0, cloud.Size())
+	minHeight, maxHeight := math.Inf(1), math.Inf(-1)
+	cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		g := ground.fromSensor(p)
+		footprint = append(footprint, r2.Point{X: g.X, Y: g.Y})
+		minHeight = math.Min(minHeight, g.Z)
+		maxHeight = math.Max(maxHeight, g.Z)
+		return true
+	})
+	return footprint, minHeight, maxHeight
+}
+
+// convexHull2D returns the convex hull of the points in counter clockwise order, using the monotone chain algorithm.
+// Collinear points are left out.
+func convexHull2D(points []r2.Point) []r2.Point {
+	pts := append([]r2.Point(nil), points...)
+	sort.Slice(pts, func(i, j int) bool {
+		if pts[i].X != pts[j].X {
+			return pts[i].X < pts[j].X
+		}
+		return pts[i].Y < pts[j].Y
+	})
+	if len(pts) < 3 {
+		return pts
+	}
+	hull := make([]r2.Point, 0, 2*len(pts))
+	// lower hull, then upper hull
+	for _, p := range pts {
+		for len(hull) >= 2 && hull[len(hull)-1].Sub(hull[len(hull)-2]).Cross(p.Sub(hull[len(hull)-2])) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(pts) - 2; i >= 0; i-- {
+		p := pts[i]
+		for len(hull) >= lower && hull[len(hull)-1].Sub(hull[len(hull)-2]).Cross(p.Sub(hull[len(hull)-2])) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	// the last point is the same as the first one
+	return hull[:len(hull)-1]
+}
+
+// minAreaRectangle returns the rectangle of smallest area around a convex polygon, using rotating calipers.
+// The rectangle is given by the angle of its first axis, and its two opposite corners in the rotated axes.
+func minAreaRectangle(hull []r2.Point) (float64, r2.Point, r2.Point) {
+	if len(hull) == 0 {
+		return 0, r2.Point{}, r2.Point{}
+	}
+	bestArea := math.Inf(1)
+	var bestAngle float64
+	var bestMin, bestMax r2.Point
+	for i := range hull {
+		edge := hull[(i+1)%len(hull)].Sub(hull[i])
+		angle := 0.
+		if edge.Norm() > 0 {
+			angle = math.Atan2(edge.Y, edge.X)
+		}
+		axisX := r2.Point{X: math.Cos(angle), Y: math.Sin(angle)}
+		axisY := axisX.Ortho()
+		minCorner := r2.Point{X: math.Inf(1), Y: math.Inf(1)}
+		maxCorner := r2.Point{X: math.Inf(-1), Y: math.Inf(-1)}
+		for _, p := range hull {
+			u, v := p.Dot(axisX), p.Dot(axisY)
+			minCorner = r2.Point{X: math.Min(minCorner.X, u), Y: math.Min(minCorner.Y, v)}
+			maxCorner = r2.Point{X: math.Max(maxCorner.X, u), Y: math.Max(maxCorner.Y, v)}
+		}
+		area := (maxCorner.X - minCorner.X) * (maxCorner.Y - minCorner.Y)
+		if area < bestArea {
+			bestArea, bestAngle, bestMin, bestMax = area, angle, minCorner, maxCorner
+		}
+	}
+	return bestAngle, bestMin, bestMax
+}
+
+// convexHull3D returns the faces of the convex hull of the points as triples of indices, ordered so that the
+// normals given by the right hand rule point outward. It returns nil if the points are all on a plane.
+// The hull is built incrementally, adding one point at a time and replacing the faces it can see.
+func convexHull3D(points []r3.Vector) [][3]int {
+	tetrahedron := initialTetrahedron(points)
+	if tetrahedron == nil {
+		return nil
+	}
+	eps := hullEpsilon(points)
+	type face struct {
+		v      [3]int
+		normal r3.Vector
+		offset float64
+	}
+	newFace := func(a, b, c int) face {
+		normal := points[b].Sub(points[a]).Cross(points[c].Sub(points[a])).Normalize()
+		return face{v: [3]int{a, b, c}, normal: normal, offset: normal.Dot(points[a])}
+	}
+	a, b, c, d := tetrahedron[0], tetrahedron[1], tetrahedron[2], tetrahedron[3]
+	// orient the first face away from the fourth point
+	if newFace(a, b, c).normal.Dot(points[d])-newFace(a, b, c).offset > 0 {
+		b, c = c, b
+	}
+	faces := []face{newFace(a, b, c), newFace(a, d, b), newFace(b, d, c), newFace(c, d, a)}
+
+	for i, p := range points {
+		if i == a || i == b || i == c || i == d {
+			continue
+		}
+		// the faces that see the point are replaced by a cone from the point to their outline
+		var visible []face
+		visibleEdges := make(map[[2]int]bool)
+		kept := faces[:0:0]
+		for _, f := range faces {
+			if f.normal.Dot(p)-f.offset > eps {
+				visible = append(visible, f)
+				for k := range 3 {
+					visibleEdges[[2]int{f.v[k], f.v[(k+1)%3]}] = true
+				}
+			} else {
+				kept = append(kept, f)
+			}
+		}
+		if len(visible) == 0 {
+			continue
+		}
+		for _, f := range visible {
+			for k := range 3 {
+				from, to := f.v[k], f.v[(k+1)%3]
+				if !visibleEdges[[2]int{to, from}] {
+					kept = append(kept, newFace(from, to, i))
+				}
+			}
+		}
+		faces = kept
+	}
+
+	hull := make([][3]int, 0, len(faces))
+	for _, f := range faces {
+		hull = append(hull, f.v)
+	}
+	return hull
+}
+
+// initialTetrahedron returns the indices of four points that are far apart and not on a plane,
+// or nil if there are none.
+func initialTetrahedron(points []r3.Vector) []int {
+	if len(points) < 4 {
+		return nil
+	}
+	eps := hullEpsilon(points)
+	farthest := func(distance func(p r3.Vector) float64) (int, float64) {
+		best, bestDist := 0, math.Inf(-1)
+		for i, p := range points {
+			if dist := distance(p); dist > bestDist {
+				best, bestDist = i, dist
+			}
+		}
+		return best, bestDist
+	}
+	first, _ := farthest(func(p r3.Vector) float64 { return -p.X })
+	second, dist := farthest(func(p r3.Vector) float64 { return p.Distance(points[first]) })
+	if dist <= eps {
+		return nil
+	}
+	line := points[second].Sub(points[first]).Normalize()
+	third, dist := farthest(func(p r3.Vector) float64 { return p.Sub(points[first]).Cross(line).Norm() })
+	if dist <= eps {
+		return nil
+	}
+	normal := line.Cross(points[third].Sub(points[first])).Normalize()
+	fourth, dist := farthest(func(p r3.Vector) float64 { return math.Abs(p.Sub(points[first]).Dot(normal)) })
+	if dist <= eps {
+		return nil
+	}
+	return []int{first, second, third, fourth}
+}
+
+// hullEpsilon is the distance under which a point is considered to be on a face of the hull,
+// relative to the extent of the points so it works at any scale.
+func hullEpsilon(points []r3.Vector) float64 {
+	extent := 0.
+	for _, p := range points {
+		extent = math.Max(extent, math.Max(math.Abs(p.X), math.Max(math.Abs(p.Y), math.Abs(p.Z))))
+	}
+	return 1e-9 * math.Max(extent, 1)
+}
+
+// hullVoxels is the number of voxels on each side of the bounding box of the points of a mesh obstacle.
+const hullVoxels = 16
+
+// hullCandidates returns the points the convex hull of a mesh obstacle is built from, at most 6 x hullVoxels²
+// of them, so the cost of convexHull3D does not grow with the size of the obstacle. In each voxel of a grid over
+// the bounding box of the points it keeps the point farthest from the center of the box, and it only keeps the
+// voxels at both ends of the rows of the grid along each axis, the others being inside. The hull of the
+// candidates is within about a voxel of the hull of all the points.
+func hullCandidates(points []r3.Vector) []r3.Vector {
+	if len(points) <= 6*hullVoxels*hullVoxels {
+		return points
+	}
+	lo, hi := points[0], points[0]
+	for _, p := range points {
+		lo = r3.Vector{X: math.Min(lo.X, p.X), Y: math.Min(lo.Y, p.Y), Z: math.Min(lo.Z, p.Z)}
+		hi = r3.Vector{X: math.Max(hi.X, p.X), Y: math.Max(hi.Y, p.Y), Z: math.Max(hi.Z, p.Z)}
+	}
+	center, size := lo.Add(hi).Mul(0.5), hi.Sub(lo).Mul(1./hullVoxels)
+	index := func(v, lo, size float64) int {
+		if size == 0 {
+			return 0
+		}
+		return min(int((v-lo)/size), hullVoxels-1)
+	}
+	voxel := func(p r3.Vector) [3]int {
+		return [3]int{index(p.X, lo.X, size.X), index(p.Y, lo.Y, size.Y), index(p.Z, lo.Z, size.Z)}
+	}
+	farthest := make(map[[3]int]int)
+	for i, p := range points {
+		key := voxel(p)
+		if j, ok := farthest[key]; !ok || p.Distance(center) > points[j].Distance(center) {
+			farthest[key] = i
+		}
+	}
+	// the first and last voxel of each row, a row being given by its axis and its indices along the two others
+	row := func(key [3]int, axis int) [3]int {
+		return [3]int{axis, key[(axis+1)%3], key[(axis+2)%3]}
+	}
+	ends := make(map[[3]int][2]int)
+	for key := range farthest {
+		for axis := range 3 {
+			end, ok := ends[row(key, axis)]
+			if !ok {
+				end = [2]int{key[axis], key[axis]}
+			}
+			ends[row(key, axis)] = [2]int{min(end[0], key[axis]), max(end[1], key[axis])}
+		}
+	}
+	candidates := make([]r3.Vector, 0, len(farthest))
+	for i, p := range points {
+		key := voxel(p)
+		if farthest[key] != i {
+			continue
+		}
+		for axis := range 3 {
+			if end := ends[row(key, axis)]; key[axis] == end[0] || key[axis] == end[1] {
+				candidates = append(candidates, p)
+				break
+			}
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,229 @@
+package obstaclespointcloud
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/golang/geo/r2"
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// rotatedBlock builds the points of a block of the given size on the ground, turned by angle radians about
+// the ground normal, in the frame of a sensor whose ground normal is the given vector.
+func rotatedBlock(t *testing.T, normal r3.Vector, angle float64, size r3.Vector) pc.PointCloud {
+	t.Helper()
+	ground := newGroundFrame(normal)
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	cloud := pc.NewBasicEmpty()
+	for x := 0.; x <= size.X; x += size.X / 10 {
+		for y := 0.; y <= size.Y; y += size.Y / 10 {
+			for z := 0.; z <= size.Z; z += size.Z / 5 {
+				p := r3.Vector{X: 100 + x*cos - y*sin, Y: -50 + x*sin + y*cos, Z: 20 + z}
+				test.That(t, cloud.Set(ground.toSensor(p), pc.NewBasicData()), test.ShouldBeNil)
+			}
+		}
+	}
+	return cloud
+}
+
+// boxDims returns the dimensions of a box geometry.
+func boxDims(t *testing.T, geometry spatialmath.Geometry) r3.Vector {
+	t.Helper()
+	box := geometry.ToProtobuf().GetBox()
+	test.That(t, box, test.ShouldNotBeNil)
+	return r3.Vector{X: box.DimsMm.X, Y: box.DimsMm.Y, Z: box.DimsMm.Z}
+}
+
+func TestConvexHull2D(t *testing.T) {
+	points := []r2.Point{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 1, Y: 1}, {X: 2, Y: 2}, {X: 0, Y: 2}, {X: 1, Y: 0}}
+	hull := convexHull2D(points)
+	test.That(t, hull, test.ShouldResemble, []r2.Point{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 2}, {X: 0, Y: 2}})
+
+	// degenerate clouds keep their points
+	test.That(t, convexHull2D([]r2.Point{{X: 1, Y: 1}}), test.ShouldHaveLength, 1)
+	angle, minCorner, maxCorner := minAreaRectangle(convexHull2D([]r2.Point{{X: 1, Y: 1}, {X: 1, Y: 1}}))
+	test.That(t, angle, test.ShouldEqual, 0)
+	test.That(t, minCorner, test.ShouldResemble, maxCorner)
+}
+
+func TestOrientedBoundingBox(t *testing.T) {
+	size := r3.Vector{X: 200, Y: 50, Z: 100}
+	for _, normal := range []r3.Vector{{X: 0, Y: 0, Z: 1}, {X: 0, Y: -1, Z: 0}, {X: 0, Y: -0.7, Z: 0.7}} {
+		for _, angle := range []float64{0, math.Pi / 6, math.Pi / 4, 2} {
+			cloud := rotatedBlock(t, normal, angle, size)
+			geometry, err := obstacleGeometry(cloud, newGroundFrame(normal), GeometryOBB, "label")
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, geometry.Label(), test.ShouldEqual, "label")
+			dims := boxDims(t, geometry)
+
+			// the box is as tight as the block, whichever way it is turned
+			test.That(t, dims.X*dims.Y, test.ShouldAlmostEqual, size.X*size.Y, 1e-6)
+			test.That(t, dims.Z, test.ShouldAlmostEqual, size.Z, 1e-6)
+
+			// and every point is inside it
+			inverse := spatialmath.PoseInverse(geometry.Pose())
+			cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+				local := spatialmath.Compose(inverse, spatialmath.NewPoseFromPoint(p)).Point()
+				test.That(t, math.Abs(local.X), test.ShouldBeLessThanOrEqualTo, dims.X/2+1e-6)
+				test.That(t, math.Abs(local.Y), test.ShouldBeLessThanOrEqualTo, dims.Y/2+1e-6)
+				test.That(t, math.Abs(local.Z), test.ShouldBeLessThanOrEqualTo, dims.Z/2+1e-6)
+				return true
+			})
+		}
+	}
+}
+
+func TestObstacleGeometryBox(t *testing.T) {
+	normal := r3.Vector{X: 0, Y: 0, Z: 1}
+	cloud := rotatedBlock(t, normal, math.Pi/4, r3.Vector{X: 200, Y: 50, Z: 100})
+	obb, err := obstacleGeometry(cloud, newGroundFrame(normal), GeometryOBB, "")
+	test.That(t, err, test.ShouldBeNil)
+	aabb, err := obstacleGeometry(cloud, newGroundFrame(normal), GeometryBox, "")
+	test.That(t, err, test.ShouldBeNil)
+	// the axis aligned box of a turned block is larger than the oriented one
+	aabbDims := boxDims(t, aabb)
+	obbDims := boxDims(t, obb)
+	test.That(t, aabbDims.X*aabbDims.Y, test.ShouldBeGreaterThan, obbDims.X*obbDims.Y)
+
+	_, err = obstacleGeometry(cloud, newGroundFrame(normal), ObstacleGeometry("cone"), "")
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+// cubeWithInside returns the corners of a cube of side 100, with points inside it and on its faces.
+func cubeWithInside() []r3.Vector {
+	points := []r3.Vector{}
+	for x := 0.; x <= 100; x += 25 {
+		for y := 0.; y <= 100; y += 25 {
+			for z := 0.; z <= 100; z += 50 {
+				points = append(points, r3.Vector{X: x, Y: y, Z: z})
+			}
+		}
+	}
+	return points
+}
+
+func TestConvexHull3D(t *testing.T) {
+	points := cubeWithInside()
+	faces := convexHull3D(points)
+	test.That(t, faces, test.ShouldNotBeNil)
+
+	// every face points outward, and every edge is shared by exactly two faces
+	edges := make(map[[2]int]int)
+	area := 0.
+	for _, f := range faces {
+		a, b, c := points[f[0]], points[f[1]], points[f[2]]
+		normal := b.Sub(a).Cross(c.Sub(a))
+		area += normal.Norm() / 2
+		for _, p := range points {
+			test.That(t, normal.Normalize().Dot(p.Sub(a)), test.ShouldBeLessThanOrEqualTo, 1e-6)
+		}
+		for k := range 3 {
+			edges[[2]int{f[k], f[(k+1)%3]}]++
+		}
+	}
+	for edge, count := range edges {
+		test.That(t, count, test.ShouldEqual, 1)
+		test.That(t, edges[[2]int{edge[1], edge[0]}], test.ShouldEqual, 1)
+	}
+	test.That(t, area, test.ShouldAlmostEqual, 6*100*100, 1e-6)
+
+	// flat points have no hull
+	flat := []r3.Vector{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 0.5, Y: 0.5}}
+	test.That(t, convexHull3D(flat), test.ShouldBeNil)
+	test.That(t, convexHull3D(flat[:3]), test.ShouldBeNil)
+}
+
+func TestHullCandidates(t *testing.T) {
+	// a dense ball of points
+	rng := rand.New(rand.NewSource(1))
+	var points []r3.Vector
+	for len(points) < 20000 {
+		p := r3.Vector{X: rng.Float64()*1000 - 500, Y: rng.Float64()*1000 - 500, Z: rng.Float64()*1000 - 500}
+		if p.Norm() <= 500 {
+			points = append(points, p)
+		}
+	}
+	candidates := hullCandidates(points)
+	test.That(t, len(candidates), test.ShouldBeLessThanOrEqualTo, 6*hullVoxels*hullVoxels)
+	// the hull of the candidates holds every point but for less than the diagonal of a voxel
+	faces := convexHull3D(candidates)
+	test.That(t, faces, test.ShouldNotBeNil)
+	outside := 0.
+	for _, f := range faces {
+		a, b, c := candidates[f[0]], candidates[f[1]], candidates[f[2]]
+		normal := b.Sub(a).Cross(c.Sub(a)).Normalize()
+		for _, p := range points {
+			outside = math.Max(outside, normal.Dot(p.Sub(a)))
+		}
+	}
+	test.That(t, outside, test.ShouldBeLessThan, math.Sqrt(3)*1000/hullVoxels)
+
+	// small obstacles are left as they are
+	test.That(t, hullCandidates(cubeWithInside()), test.ShouldResemble, cubeWithInside())
+}
+
+func TestObstacleGeometryKinds(t *testing.T) {
+	normal := r3.Vector{X: 0, Y: -0.7, Z: 0.7}
+	ground := newGroundFrame(normal)
+	cloud := rotatedBlock(t, normal, math.Pi/6, r3.Vector{X: 200, Y: 50, Z: 100})
+	obb, err := obstacleGeometry(cloud, ground, GeometryOBB, "")
+	test.That(t, err, test.ShouldBeNil)
+	obbDims := boxDims(t, obb)
+
+	for _, kind := range []ObstacleGeometry{GeometryHullPrism, GeometryMesh} {
+		geometry, err := obstacleGeometry(cloud, ground, kind, "label")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, geometry.Label(), test.ShouldEqual, "label")
+		mesh, ok := geometry.(*spatialmath.Mesh)
+		test.That(t, ok, test.ShouldBeTrue)
+		// the hull of a block is the block, every point is inside or on every face
+		area := 0.
+		inverse := spatialmath.PoseInverse(mesh.Pose())
+		for _, triangle := range mesh.Triangles() {
+			area += triangle.Area()
+			cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+				local := spatialmath.Compose(inverse, spatialmath.NewPoseFromPoint(p)).Point()
+				test.That(t, triangle.Normal().Dot(local.Sub(triangle.Points()[0])), test.ShouldBeLessThanOrEqualTo, 1e-6)
+				return true
+			})
+		}
+		blockArea := 2 * (obbDims.X*obbDims.Y + obbDims.X*obbDims.Z + obbDims.Y*obbDims.Z)
+		test.That(t, area, test.ShouldAlmostEqual, blockArea, 1e-6)
+	}
+
+	for _, kind := range []ObstacleGeometry{GeometrySphere, GeometryCapsule} {
+		geometry, err := obstacleGeometry(cloud, ground, kind, "label")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, geometry.Label(), test.ShouldEqual, "label")
+		cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+			collides, _, err := geometry.CollidesWith(spatialmath.NewPoint(p, ""), 1e-6)
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, collides, test.ShouldBeTrue)
+			return true
+		})
+	}
+	capsule, err := obstacleGeometry(cloud, ground, GeometryCapsule, "")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, capsule.ToProtobuf().GetCapsule(), test.ShouldNotBeNil)
+	sphere, err := obstacleGeometry(cloud, ground, GeometrySphere, "")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sphere.ToProtobuf().GetSphere(), test.ShouldNotBeNil)
+
+	// a flat obstacle has no 3D hull and its prism no height, both fall back to the oriented box
+	flat := pc.NewBasicEmpty()
+	for x := 0.; x <= 100; x += 10 {
+		for y := 0.; y <= 100; y += 10 {
+			test.That(t, flat.Set(ground.toSensor(r3.Vector{X: x, Y: y, Z: 50}), pc.NewBasicData()), test.ShouldBeNil)
+		}
+	}
+	for _, kind := range []ObstacleGeometry{GeometryHullPrism, GeometryMesh} {
+		geometry, err := obstacleGeometry(flat, ground, kind, "")
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, geometry.ToProtobuf().GetBox(), test.ShouldNotBeNil)
+	}
+}
@@ -0,0 +1,169 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/utils"
+	"go.viam.com/rdk/vision/segmentation"
+)
+
+// ransacIterations is the number of candidate planes tried by RANSAC, the same as the segmentation package.
+const ransacIterations = 2000
+
+// minPlaneCandidates is the number of candidate planes scored even past the deadline, so that a run that is out of
+// time still removes the ground instead of returning it as obstacles.
+const minPlaneCandidates = 100
+
+// findGroundPlane finds the plane with the most points within cfg.AngleTolerance of cfg.NormalVec using RANSAC,
+// and returns it along with the points that are not on it. If the plane does not have more than cfg.MinPtsInPlane
+// points, no plane is returned and all the points are kept.
+// It is adapted from segmentation.SegmentPlaneWRTGround in RDK, which samples and scores the candidates the same
+// way. It is copied rather than called because that function scores every candidate through
+// utils.GroupWorkParallel, which never looks at ctx and has no deadline, so a cancelled call or one past
+// max_processing_time_ms would still run to the end. This one stops as soon as ctx is done. If deadline is not
+// zero, the search stops trying candidate planes once it passes and the first minPlaneCandidates are scored, and
+// uses the best plane so far, which is reported by the returned bool. The candidates are scored by cfg.ClusteringWorkers goroutines.
+func findGroundPlane(
+	ctx context.Context, cloud pc.PointCloud, cfg *ErCCLConfig, deadline time.Time,
+) (pc.Plane, pc.PointCloud, bool, error) {
+	return findPlane(ctx, cloud, cfg, func(normal r3.Vector) bool {
+		return math.Acos(cfg.NormalVec.Dot(normal)) <= cfg.AngleTolerance*math.Pi/180.0
+	}, deadline)
+}
+
+// findPlane finds the plane with the most points among the RANSAC candidates whose unit normal is accepted,
+// the same way as findGroundPlane.
+func findPlane(
+	ctx context.Context, cloud pc.PointCloud, cfg *ErCCLConfig, accept func(normal r3.Vector) bool, deadline time.Time,
+) (pc.Plane, pc.PointCloud, bool, error) {
+	if cloud.Size() <= 3 {
+		// if point cloud does not have even 3 points, return original cloud with no planes
+		return nil, cloud, false, nil
+	}
+	pts, data := segmentation.GetPointCloudPositions(cloud)
+	equations := candidatePlanes(pts, accept)
+
+	// score the candidates in parallel, each worker takes every workers-th candidate. The workers of the
+	// clustering are reused, so clustering_workers sizes both stages.
+	workers := max(1, cfg.ClusteringWorkers)
+	type candidate struct {
+		index, inliers int
+	}
+	best := make([]candidate, workers)
+	var capped atomic.Bool
+	var wg sync.WaitGroup
+	for w := range workers {
+		best[w] = candidate{index: -1}
+		wg.Go(func() {
+			for k := w; k < len(equations); k += workers {
+				if ctx.Err() != nil {
+					return
+				}
+				if k >= minPlaneCandidates && !deadline.IsZero() && time.Now().After(deadline) {
+					capped.Store(true)
+					return
+				}
+				inliers := 0
+				for _, pt := range pts {
+					if math.Abs(planeDistance(equations[k], pt)) < cfg.MaxDistFromPlane {
+						inliers++
+					}
+				}
+				if best[w].index == -1 || inliers > best[w].inliers {
+					best[w] = candidate{index: k, inliers: inliers}
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, false, err
+	}
+	bestEquation := -1
+	bestInliers := 0
+	for _, c := range best {
+		if c.index == -1 {
+			continue
+		}
+		if bestEquation == -1 || c.inliers > bestInliers || (c.inliers == bestInliers && c.index < bestEquation) {
+			bestEquation, bestInliers = c.index, c.inliers
+		}
+	}
+	if bestEquation == -1 || bestInliers <= cfg.MinPtsInPlane {
+		return nil, cloud, capped.Load(), nil
+	}
+
+	plane, nonPlane, err := splitByPlane(ctx, pts, data, equations[bestEquation], bestInliers, cfg)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return plane, nonPlane, capped.Load(), nil
+}
+
+// splitByPlane returns the plane of the given equation with the points within cfg.MaxDistFromPlane of it, and
+// the cloud of the other points. inliers is the expected number of points on the plane, used to size the clouds.
+func splitByPlane(
+	ctx context.Context, pts []r3.Vector, data []pc.Data, equation [4]float64, inliers int, cfg *ErCCLConfig,
+) (pc.Plane, pc.PointCloud, error) {
+	planeCloud := pc.NewBasicPointCloud(inliers)
+	nonPlaneCloud := pc.NewBasicPointCloud(max(0, len(pts)-inliers))
+	planeCloudCenter := r3.Vector{}
+	for i, pt := range pts {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		var err error
+		if math.Abs(planeDistance(equation, pt)) < cfg.MaxDistFromPlane {
+			planeCloudCenter = planeCloudCenter.Add(pt)
+			err = planeCloud.Set(pt, data[i])
+		} else {
+			err = nonPlaneCloud.Set(pt, data[i])
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error setting point (%v, %v, %v) in point cloud", pt.X, pt.Y, pt.Z)
+		}
+	}
+	planeCloudCenter = planeCloudCenter.Mul(1. / float64(max(1, planeCloud.Size())))
+	return pc.NewPlaneWithCenter(planeCloud, equation, planeCloudCenter), nonPlaneCloud, nil
+}
+
+// candidatePlanes returns the equations [0]x + [1]y + [2]z + [3] = 0 of the planes through random triplets of
+// points whose unit normal is accepted. The random source is seeded so the candidates are the same for the
+// same points.
+func candidatePlanes(pts []r3.Vector, accept func(normal r3.Vector) bool) [][4]float64 {
+	//nolint:gosec
+	r := rand.New(rand.NewSource(1))
+	nPoints := len(pts)
+	equations := make([][4]float64, 0, ransacIterations)
+	for i := 0; i < ransacIterations; i++ {
+		// sample 3 Points from the slice of 3D Points
+		p1 := pts[utils.SampleRandomIntRange(1, nPoints-1, r)]
+		p2 := pts[utils.SampleRandomIntRange(1, nPoints-1, r)]
+		p3 := pts[utils.SampleRandomIntRange(1, nPoints-1, r)]
+		// cross product of 2 vectors of the plane to get its normal
+		planeVec := p2.Sub(p1).Cross(p3.Sub(p1)).Normalize()
+		d := -planeVec.Dot(p2)
+		if !accept(planeVec) {
+			continue
+		}
+		equations = append(equations, [4]float64{planeVec.X, planeVec.Y, planeVec.Z, d})
+	}
+	return equations
+}
+
+// planeDistance returns the signed distance of a point to the plane of the given equation.
+func planeDistance(equation [4]float64, pt r3.Vector) float64 {
+	norm := math.Sqrt(equation[0]*equation[0] + equation[1]*equation[1] + equation[2]*equation[2])
+	return (equation[0]*pt.X + equation[1]*pt.Y + equation[2]*pt.Z + equation[3]) / norm
+}
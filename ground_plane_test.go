@@ -0,0 +1,100 @@
+package obstaclespointcloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+)
+
+func TestGroundPlaneCommand(t *testing.T) {
+	cam := &inject.Camera{}
+	// the ground is 100 mm below the camera, and tilted 45 degrees away from the configured normal
+	normal := r3.Vector{X: 0, Y: -1, Z: 1}.Normalize()
+	scene, _ := tiltedScene(t, normal)
+	cloud := pc.NewBasicEmpty()
+	scene.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		test.That(t, cloud.Set(p.Sub(normal.Mul(100)), d), test.ShouldBeNil)
+		return true
+	})
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return cloud, nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:        500,
+		MinPtsInSegment:      20,
+		MaxDistFromPlane:     5,
+		ClusteringRadius:     10,
+		AngleTolerance:       50,
+		GroundPlaneNormalVec: NormalVec{Z: 1},
+		DefaultCamera:        "fakeCamera",
+	}
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_plane"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	cmd := map[string]interface{}{"command": "get_ground_plane"}
+	_, err = service.DoCommand(context.Background(), cmd)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no point cloud")
+
+	_, err = service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	resp, err := service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["found"], test.ShouldBeTrue)
+	got := resp["normal"].(map[string]interface{})
+	test.That(t, got["x"], test.ShouldAlmostEqual, normal.X, 1e-3)
+	test.That(t, got["y"], test.ShouldAlmostEqual, normal.Y, 1e-3)
+	test.That(t, got["z"], test.ShouldAlmostEqual, normal.Z, 1e-3)
+	test.That(t, resp["offset_mm"], test.ShouldAlmostEqual, 100, 1e-3)
+	test.That(t, resp["angle_degs"], test.ShouldAlmostEqual, 45, 1e-3)
+	test.That(t, resp["inlier_count"], test.ShouldEqual, 40*40)
+	test.That(t, resp["pcd"], test.ShouldBeNil)
+
+	cmd["include_points"] = true
+	resp, err = service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	data, err := base64.StdEncoding.DecodeString(resp["pcd"].(string))
+	test.That(t, err, test.ShouldBeNil)
+	planeCloud, err := pc.ReadPCD(bytes.NewReader(data), "")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, planeCloud.Size(), test.ShouldEqual, 40*40)
+}
+
+func TestGroundPlaneCommandNoPlane(t *testing.T) {
+	cam := &inject.Camera{}
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return pc.NewBasicEmpty(), nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObstaclesPointCloudConfig{DefaultCamera: "fakeCamera"}
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_plane"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	resp, err := service.DoCommand(context.Background(), map[string]interface{}{"command": "get_ground_plane"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp, test.ShouldResemble, map[string]interface{}{"found": false})
+}
+
+func TestFindGroundPlanePastDeadline(t *testing.T) {
+	cloud, _ := tiltedScene(t, r3.Vector{Z: 1})
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MaxDistFromPlane: 5}
+	cfg.SetDefaultValues()
+	// out of time before the search starts, the first candidates still find the ground
+	plane, nonPlane, capped, err := findGroundPlane(context.Background(), cloud, cfg, time.Now().Add(-time.Second))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, capped, test.ShouldBeTrue)
+	test.That(t, plane, test.ShouldNotBeNil)
+	test.That(t, plane.Normal().Z, test.ShouldAlmostEqual, 1, 1e-6)
+	test.That(t, nonPlane.Size(), test.ShouldEqual, 2*7*7*9)
+}
@@ -0,0 +1,94 @@
+package obstaclespointcloud
+
+import (
+	"github.com/golang/geo/r3"
+)
+
+// initialVelocityVariance is the variance, in (mm/s)², of the velocity of a new track, which is not known yet.
+const initialVelocityVariance = 1e6
+
+// axisFilter is the state of a constant velocity Kalman filter along one axis.
+// The axes are independent, since the motion model and the measurements do not mix them.
+type axisFilter struct {
+	position, velocity float64
+	// covariance of (position, velocity)
+	p [2][2]float64
+}
+
+// constantVelocityFilter estimates the position and velocity of an obstacle from the positions of its center,
+// assuming it moves at a constant velocity disturbed by random accelerations.
+type constantVelocityFilter struct {
+	axes [3]axisFilter
+	// processNoise is the variance of the accelerations in (mm/s²)², measurementNoise the variance of
+	// the measured positions in mm²
+	processNoise, measurementNoise float64
+}
+
+// newConstantVelocityFilter returns a filter at rest at the given position.
+// The noises are standard deviations, of the acceleration in mm/s² and of the measured positions in mm.
+func newConstantVelocityFilter(position r3.Vector, processNoise, measurementNoise float64) *constantVelocityFilter {
+	f := &constantVelocityFilter{processNoise: processNoise * processNoise, measurementNoise: measurementNoise * measurementNoise}
+	for i, x := range []float64{position.X, position.Y, position.Z} {
+		f.axes[i] = axisFilter{position: x, p: [2][2]float64{{f.measurementNoise, 0}, {0, initialVelocityVariance}}}
+	}
+	return f
+}
+
+// predict moves the state dt seconds forward.
+func (f *constantVelocityFilter) predict(dt float64) {
+	if dt <= 0 {
+		return
+	}
+	// process noise of a white acceleration over dt
+	q00 := f.processNoise * dt * dt * dt * dt / 4
+	q01 := f.processNoise * dt * dt * dt / 2
+	q11 := f.processNoise * dt * dt
+	for i := range f.axes {
+		a := &f.axes[i]
+		a.position += a.velocity * dt
+		p := a.p
+		a.p[0][0] = p[0][0] + dt*(p[0][1]+p[1][0]) + dt*dt*p[1][1] + q00
+		a.p[0][1] = p[0][1] + dt*p[1][1] + q01
+		a.p[1][0] = p[1][0] + dt*p[1][1] + q01
+		a.p[1][1] = p[1][1] + q11
+	}
+}
+
+// correct updates the state with a measured position.
+func (f *constantVelocityFilter) correct(measured r3.Vector) {
+	for i, z := range []float64{measured.X, measured.Y, measured.Z} {
+		a := &f.axes[i]
+		p := a.p
+		s := p[0][0] + f.measurementNoise
+		k0, k1 := p[0][0]/s, p[1][0]/s
+		innovation := z - a.position
+		a.position += k0 * innovation
+		a.velocity += k1 * innovation
+		a.p[0][0] = (1 - k0) * p[0][0]
+		a.p[0][1] = (1 - k0) * p[0][1]
+		a.p[1][0] = p[1][0] - k1*p[0][0]
+		a.p[1][1] = p[1][1] - k1*p[0][1]
+	}
+}
+
+// position returns the estimated position in mm.
+func (f *constantVelocityFilter) position() r3.Vector {
+	return r3.Vector{X: f.axes[0].position, Y: f.axes[1].position, Z: f.axes[2].position}
+}
+
+// velocity returns the estimated velocity in mm/s.
+func (f *constantVelocityFilter) velocity() r3.Vector {
+	return r3.Vector{X: f.axes[0].velocity, Y: f.axes[1].velocity, Z: f.axes[2].velocity}
+}
+
+// covariance returns the covariance of the state (x, y, z, vx, vy, vz), row by row.
+func (f *constantVelocityFilter) covariance() [6][6]float64 {
+	var c [6][6]float64
+	for i, a := range f.axes {
+		c[i][i] = a.p[0][0]
+		c[i][i+3] = a.p[0][1]
+		c[i+3][i] = a.p[1][0]
+		c[i+3][i+3] = a.p[1][1]
+	}
+	return c
+}
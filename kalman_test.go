@@ -0,0 +1,62 @@
+package obstaclespointcloud
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/vision"
+)
+
+func TestConstantVelocityFilter(t *testing.T) {
+	velocity := r3.Vector{X: 800, Y: -300, Z: 0}
+	start := r3.Vector{X: 1000, Y: 2000, Z: 50}
+	//nolint:gosec
+	r := rand.New(rand.NewSource(1))
+	noisy := func(p r3.Vector) r3.Vector {
+		return p.Add(r3.Vector{X: r.NormFloat64() * 20, Y: r.NormFloat64() * 20, Z: r.NormFloat64() * 20})
+	}
+	f := newConstantVelocityFilter(noisy(start), 100, 20)
+	initial := f.covariance()
+	dt := 0.1
+	for k := 1; k <= 100; k++ {
+		f.predict(dt)
+		f.correct(noisy(start.Add(velocity.Mul(dt * float64(k)))))
+	}
+	test.That(t, f.velocity().Distance(velocity), test.ShouldBeLessThan, 50)
+	test.That(t, f.position().Distance(start.Add(velocity.Mul(10))), test.ShouldBeLessThan, 30)
+
+	// the filter is more certain than at the start, and its covariance is symmetric
+	covariance := f.covariance()
+	for i := range 6 {
+		test.That(t, covariance[i][i], test.ShouldBeLessThan, initial[i][i])
+		for j := range 6 {
+			test.That(t, covariance[i][j], test.ShouldAlmostEqual, covariance[j][i], 1e-9)
+		}
+	}
+
+	// predicting with no measurements makes it less certain
+	f.predict(1)
+	test.That(t, f.covariance()[3][3], test.ShouldBeGreaterThan, covariance[3][3])
+}
+
+func TestTrackerVelocity(t *testing.T) {
+	tr := newTracker(TrackerConfig{ConfirmHits: 2})
+	start := time.Unix(0, 0)
+	// one obstacle coming toward the sensor at 1m/s, one standing still
+	for k := range 30 {
+		x := 3000 - 100*float64(k)
+		objects := []*vision.Object{cubeObject(t, r3.Vector{X: x}), cubeObject(t, r3.Vector{X: 0, Y: 2000})}
+		tr.update(objects, start.Add(time.Duration(k)*100*time.Millisecond))
+	}
+	tracks := tr.confirmedTracks()
+	test.That(t, tracks, test.ShouldHaveLength, 2)
+	test.That(t, tracks[0].Velocity.Distance(r3.Vector{X: -1000}), test.ShouldBeLessThan, 20)
+	test.That(t, tracks[0].Position.X, test.ShouldAlmostEqual, 100, 20)
+	test.That(t, tracks[1].Velocity.Norm(), test.ShouldBeLessThan, 1)
+	test.That(t, math.Sqrt(tracks[0].Covariance[3][3]), test.ShouldBeLessThan, math.Sqrt(initialVelocityVariance)/2)
+}
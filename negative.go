@@ -0,0 +1,166 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang/geo/r3"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/vision"
+)
+
+// NegativeObstacleLabel is the label of the holes and drops in the ground.
+const NegativeObstacleLabel = "negative_obstacle"
+
+// Default values of the negative obstacle detection.
+const (
+	NegativeObstacleDepthDefault      = 100.
+	NegativeObstacleMaxGapDefault     = 500.
+	NegativeObstacleResolutionDefault = 50.
+	NegativeObstacleExtentDefault     = 10000.
+	// negativeObstacleMinCells is the number of cells of the smallest negative obstacle, so that a stray point
+	// below the ground or a single missing return is not one.
+	negativeObstacleMinCells = 2
+)
+
+// splitBelowGround returns the points that are more than depth below the ground plane, and the other points.
+func splitBelowGround(
+	ctx context.Context, cloud pc.PointCloud, plane pc.Plane, ground groundFrame, depth float64,
+) (pc.PointCloud, pc.PointCloud, error) {
+	normal, offset := planeEquation(plane, ground.normal)
+	below := pc.NewBasicEmpty()
+	rest := pc.NewBasicPointCloud(cloud.Size())
+	var setErr error
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		if normal.Dot(p)+offset < -depth {
+			setErr = below.Set(p, d)
+		} else {
+			setErr = rest.Set(p, d)
+		}
+		return setErr == nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if setErr != nil {
+		return nil, nil, setErr
+	}
+	return below, rest, nil
+}
+
+// negativeObstacles returns the holes and drops of the ground around the sensor, labeled NegativeObstacleLabel.
+// They are made of the cells of a grid on the ground plane that have points more than cfg.NegativeObstacleDepth
+// below it, and of the cells where ground is expected but none was seen: the unknown cells that have ground both
+// toward the sensor and away from it, less than cfg.NegativeObstacleMaxGap apart. The shadows of the obstacles
+// are not holes, since the obstacle is between them and the sensor. The points of the ground plane are in
+// res.plane, the points below it in below and the points above it in above. The grid is cfg.NegativeObstacleExtent
+// wide, and the negative obstacles of a degraded run are labeled DegradedLabel too.
+func negativeObstacles(
+	ctx context.Context, res *erCCLResult, below, above pc.PointCloud, cfg *ErCCLConfig,
+) ([]*vision.Object, error) {
+	if res.plane == nil {
+		return nil, nil
+	}
+	groundHeight := res.ground.fromSensor(res.plane.Center()).Z
+	grid, err := newOccupancyGrid(res.ground, groundHeight, cfg.NegativeObstacleResolution, cfg.NegativeObstacleExtent)
+	if err != nil {
+		return nil, err
+	}
+	planeCloud, err := res.plane.PointCloud()
+	if err != nil {
+		return nil, err
+	}
+	grid.mark(planeCloud, OccupancyFree)
+	grid.mark(above, OccupancyOccupied)
+
+	negative := make([]bool, len(grid.cells))
+	belowPoints := make(map[int][]r3.Vector)
+	err = iterateWithContext(ctx, below, func(p r3.Vector, d pc.Data) bool {
+		if i, ok := grid.cell(p); ok {
+			negative[i] = true
+			belowPoints[i] = append(belowPoints[i], p)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	maxGap := cfg.NegativeObstacleMaxGap / grid.resolution
+	for i, state := range grid.cells {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if state == OccupancyUnknown && !negative[i] && grid.missingGround(i, maxGap) {
+			negative[i] = true
+		}
+	}
+
+	label := NegativeObstacleLabel
+	if res.degraded {
+		label = DegradedLabel + " " + label
+	}
+	objects := []*vision.Object{}
+	for _, component := range gridComponents(grid.side, func(i int) bool { return negative[i] }) {
+		if len(component) < negativeObstacleMinCells {
+			continue
+		}
+		// the obstacle goes from the ground down to the points below it, or to the depth if none were seen
+		cloud := pc.NewBasicEmpty()
+		for _, i := range component {
+			x, y := grid.cellCenter(i)
+			points := []r3.Vector{res.ground.toSensor(r3.Vector{X: x, Y: y, Z: groundHeight})}
+			if len(belowPoints[i]) == 0 {
+				points = append(points, res.ground.toSensor(r3.Vector{X: x, Y: y, Z: groundHeight - cfg.NegativeObstacleDepth}))
+			}
+			for _, p := range append(points, belowPoints[i]...) {
+				if err := cloud.Set(p, pc.NewBasicData()); err != nil {
+					return nil, err
+				}
+			}
+		}
+		geometry, err := obstacleGeometry(cloud, res.ground, cfg.ObstacleGeometry, label)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, &vision.Object{PointCloud: cloud, Geometry: geometry})
+	}
+	return objects, nil
+}
+
+// missingGround returns whether the first known cells toward the sensor and away from it, from cell i, are both
+// free, and less than maxGap cells apart.
+func (g *occupancyGrid) missingGround(i int, maxGap float64) bool {
+	row, col := i/g.side, i%g.side
+	// the sensor is above the center of the grid
+	center := float64(g.side) / 2
+	toward := r3.Vector{X: center - (float64(col) + 0.5), Y: center - (float64(row) + 0.5)}
+	if toward.Norm() < 1 {
+		return false
+	}
+	toward = toward.Normalize()
+	walk := func(dir r3.Vector) (float64, bool) {
+		for t := 0.5; t <= maxGap; t += 0.5 {
+			c := int(math.Floor(float64(col) + 0.5 + dir.X*t))
+			r := int(math.Floor(float64(row) + 0.5 + dir.Y*t))
+			if c < 0 || r < 0 || c >= g.side || r >= g.side {
+				return 0, false
+			}
+			if r == row && c == col {
+				continue
+			}
+			if state := g.cells[r*g.side+c]; state != OccupancyUnknown {
+				return t, state == OccupancyFree
+			}
+		}
+		return 0, false
+	}
+	near, ok := walk(toward)
+	if !ok {
+		return false
+	}
+	far, ok := walk(toward.Mul(-1))
+	return ok && near+far <= maxGap
+}
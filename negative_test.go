@@ -0,0 +1,103 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// warehouseScene builds a cloud of a floor 500 mm below the sensor, with a drain in it, a drop to a lower floor
+// along one side, and a box that hides the floor behind it.
+func warehouseScene(t *testing.T) pc.PointCloud {
+	t.Helper()
+	return scene{
+		groundMin:  r3.Vector{X: -1000, Y: -1000},
+		groundMax:  r3.Vector{X: 1000, Y: 1000},
+		groundStep: 10,
+		height: func(x, _ float64) float64 {
+			// the lower floor past the drop
+			if x < -600 {
+				return -900
+			}
+			return -500
+		},
+		hole: func(x, y float64) bool {
+			// the drain, where nothing comes back from, under the box, and in its shadow
+			return x >= 300 && x < 450 && y >= -75 && y < 75 ||
+				math.Abs(x) <= 50 && y >= 450 && y <= 550 ||
+				y > 550 && y < 900 && math.Abs(x) < 50*y/550
+		},
+		boxes: []sceneBox{{min: r3.Vector{X: -50, Y: 450, Z: 20}, max: r3.Vector{X: 50, Y: 550, Z: 200}, step: r3.Vector{X: 10, Y: 10, Z: 20}}},
+	}.cloud(t)
+}
+
+func TestNegativeObstacles(t *testing.T) {
+	cloud := warehouseScene(t)
+	cfg := &ErCCLConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 5,
+		GridResolution:   20,
+	}
+	cfg.SetDefaultValues()
+
+	// the lower floor is an obstacle like any other
+	res, err := segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.objects, test.ShouldHaveLength, 2)
+
+	cfg.NegativeObstacles = true
+	res, err = segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	var box, drain, drop *pc.MetaData
+	negatives := 0
+	for _, obj := range res.objects {
+		meta := obj.PointCloud.MetaData()
+		switch {
+		case obj.Geometry.Label() != NegativeObstacleLabel:
+			box = &meta
+		case meta.MaxX < 0:
+			drop = &meta
+			negatives++
+		default:
+			drain = &meta
+			negatives++
+		}
+	}
+	// the shadow of the box is not a hole
+	test.That(t, res.objects, test.ShouldHaveLength, 3)
+	test.That(t, negatives, test.ShouldEqual, 2)
+	test.That(t, box.MinY, test.ShouldEqual, 450)
+	// the drain goes from the floor down to the default depth
+	test.That(t, drain.MinX, test.ShouldBeBetween, 300, 350)
+	test.That(t, drain.MaxX, test.ShouldBeBetween, 350, 450)
+	test.That(t, drain.MinZ, test.ShouldAlmostEqual, -500-NegativeObstacleDepthDefault, 1e-6)
+	test.That(t, drain.MaxZ, test.ShouldAlmostEqual, -500, 1e-6)
+	// the drop goes from the floor down to the lower floor
+	test.That(t, drop.MinX, test.ShouldBeLessThan, -950)
+	test.That(t, drop.MaxX, test.ShouldBeGreaterThan, -650)
+	test.That(t, drop.MinZ, test.ShouldAlmostEqual, -900, 1e-6)
+	test.That(t, drop.MaxZ, test.ShouldAlmostEqual, -500, 1e-6)
+
+	// the negative obstacles of a degraded run are labeled so
+	res.degraded = true
+	negativeObjects, err := negativeObstacles(context.Background(), res, pc.NewBasicEmpty(), res.obstaclePoints, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, negativeObjects, test.ShouldNotBeEmpty)
+	for _, obj := range negativeObjects {
+		test.That(t, obj.Geometry.Label(), test.ShouldEqual, DegradedLabel+" "+NegativeObstacleLabel)
+	}
+
+	// the drop is out of a smaller grid
+	cfg.NegativeObstacleExtent = 1000
+	res, err = segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.negatives, test.ShouldHaveLength, 1)
+	test.That(t, res.negatives[0].PointCloud.MetaData().MinX, test.ShouldBeBetween, 300, 350)
+}
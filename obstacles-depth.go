@@ -5,6 +5,7 @@ package obstaclespointcloud
 import (
 	"context"
 	"sort"
+	"sync"
 
 	"github.com/golang/geo/r3"
 	"github.com/pkg/errors"
@@ -12,10 +13,12 @@ import (
 
 	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
+	pc "go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/rimage"
 	"go.viam.com/rdk/rimage/depthadapter"
 	"go.viam.com/rdk/rimage/transform"
+	"go.viam.com/rdk/robot/framesystem"
 	svision "go.viam.com/rdk/services/vision"
 	"go.viam.com/rdk/spatialmath"
 	vision "go.viam.com/rdk/vision"
@@ -39,19 +42,66 @@ func init() {
 
 // ObsDepthConfig specifies the parameters to be used for the obstacle depth service.
 type ObsDepthConfig struct {
-	MinPtsInPlane        int     `json:"min_points_in_plane"`
-	MinPtsInSegment      int     `json:"min_points_in_segment"`
-	MaxDistFromPlane     float64 `json:"max_dist_from_plane_mm"`
-	ClusteringRadius     int     `json:"clustering_radius"`
-	ClusteringStrictness float64 `json:"clustering_strictness"`
-	AngleTolerance       float64 `json:"ground_angle_tolerance_degs"`
-	DefaultCamera        string  `json:"camera_name"`
+	MinPtsInPlane                  int               `json:"min_points_in_plane"`
+	MinPtsInSegment                int               `json:"min_points_in_segment"`
+	MaxDistFromPlane               float64           `json:"max_dist_from_plane_mm"`
+	ClusteringRadius               int               `json:"clustering_radius"`
+	ClusteringStrictness           float64           `json:"clustering_strictness"`
+	ClusteringAlpha                float64           `json:"clustering_alpha"`
+	GridResolution                 float64           `json:"grid_resolution_mm"`
+	GridCells                      int               `json:"grid_cells"`
+	ClusteringWorkers              int               `json:"clustering_workers"`
+	MaxProcessingTime              int               `json:"max_processing_time_ms"`
+	Neighborhood                   string            `json:"clustering_neighborhood"`
+	ObstacleGeometry               string            `json:"obstacle_geometry"`
+	MaxPlanesToRemove              int               `json:"max_planes_to_remove"`
+	PlaneOrientations              []string          `json:"plane_orientations"`
+	PlaneAngleTolerance            float64           `json:"plane_angle_tolerance_degs"`
+	GroundSegmentation             string            `json:"ground_segmentation"`
+	GroundZoneSize                 float64           `json:"ground_zone_size_mm"`
+	NegativeObstacles              bool              `json:"negative_obstacles"`
+	NegativeObstacleDepth          float64           `json:"negative_obstacle_depth_mm"`
+	NegativeObstacleMaxGap         float64           `json:"negative_obstacle_max_gap_mm"`
+	NegativeObstacleResolution     float64           `json:"negative_obstacle_resolution_mm"`
+	NegativeObstacleExtent         float64           `json:"negative_obstacle_extent_mm"`
+	VoxelSize                      float64           `json:"voxel_size_mm"`
+	VoxelMode                      string            `json:"voxel_mode"`
+	FullResolutionObjects          bool              `json:"full_resolution_objects"`
+	StatisticalOutlierRemoval      bool              `json:"statistical_outlier_removal"`
+	StatisticalOutlierNeighbors    int               `json:"statistical_outlier_neighbors"`
+	StatisticalOutlierStdDev       float64           `json:"statistical_outlier_std_dev"`
+	RadiusOutlierRemoval           bool              `json:"radius_outlier_removal"`
+	RadiusOutlierRadius            float64           `json:"radius_outlier_radius_mm"`
+	RadiusOutlierMinNeighbors      int               `json:"radius_outlier_min_neighbors"`
+	RangeAdaptiveClustering        RangeCurve        `json:"range_adaptive_clustering"`
+	ClusteringMode                 string            `json:"clustering_mode"`
+	RangeImageVerticalResolution   float64           `json:"range_image_vertical_resolution_degs"`
+	RangeImageHorizontalResolution float64           `json:"range_image_horizontal_resolution_degs"`
+	RangeImageAngleThreshold       float64           `json:"range_image_angle_threshold_degs"`
+	TemporalFusion                 bool              `json:"temporal_fusion"`
+	FusionHitProbability           float64           `json:"fusion_hit_probability"`
+	FusionMissProbability          float64           `json:"fusion_miss_probability"`
+	FusionOccupiedProbability      float64           `json:"fusion_occupied_probability"`
+	FusionHalfLife                 int               `json:"fusion_half_life_ms"`
+	FusionResolution               float64           `json:"fusion_resolution_mm"`
+	FusionExtent                   float64           `json:"fusion_extent_mm"`
+	GroundPlaneCache               bool              `json:"ground_plane_cache"`
+	GroundPlaneCacheMinInlierRatio float64           `json:"ground_plane_cache_min_inlier_ratio"`
+	GroundPlaneCacheMaxFrames      int               `json:"ground_plane_cache_max_frames"`
+	RegionOfInterest               *RegionOfInterest `json:"region_of_interest"`
+	OutputFrame                    string            `json:"output_frame"`
+	AngleTolerance                 float64           `json:"ground_angle_tolerance_degs"`
+	DefaultCamera                  string            `json:"camera_name"`
 }
 
 // obsDepth is the underlying struct actually used by the service.
 type obsDepth struct {
 	clusteringConf *ErCCLConfig
-	intrinsics     *transform.PinholeCameraIntrinsics
+	pipeline       *pipeline
+
+	// mu guards intrinsics, which GetObjectPointClouds and the calibrate_extrinsics command set concurrently
+	mu         sync.Mutex
+	intrinsics *transform.PinholeCameraIntrinsics
 }
 
 func (cfg *ObsDepthConfig) Validate(path string) ([]string, []string, error) {
@@ -82,10 +132,186 @@ func (cfg *ObsDepthConfig) Validate(path string) ([]string, []string, error) {
 		return nil, optionalDeps, errors.New("clustering_strictness must be non-negative")
 	}
 
+	if cfg.ClusteringAlpha < 0 || cfg.ClusteringAlpha > 1 {
+		return nil, optionalDeps, errors.New("clustering_alpha must be between 0 and 1")
+	}
+
+	if cfg.GridResolution < 0 {
+		return nil, optionalDeps, errors.New("grid_resolution_mm must be non-negative")
+	}
+
+	if cfg.GridCells < 0 {
+		return nil, optionalDeps, errors.New("grid_cells must be non-negative")
+	}
+
+	if cfg.GridResolution != 0 && cfg.GridCells != 0 {
+		return nil, optionalDeps, errors.New("only one of grid_resolution_mm and grid_cells can be set")
+	}
+
+	if cfg.ClusteringWorkers < 0 {
+		return nil, optionalDeps, errors.New("clustering_workers must be non-negative")
+	}
+
+	switch Neighborhood(cfg.Neighborhood) {
+	case "", NeighborhoodQuadrant, NeighborhoodSquare, NeighborhoodDisk:
+	default:
+		return nil, optionalDeps, errors.Errorf(`clustering_neighborhood must be one of "quadrant", "square" or "disk", got %q`, cfg.Neighborhood)
+	}
+
+	switch ObstacleGeometry(cfg.ObstacleGeometry) {
+	case "", GeometryBox, GeometryOBB, GeometryHullPrism, GeometryMesh, GeometrySphere, GeometryCapsule:
+	default:
+		return nil, optionalDeps, errors.Errorf(
+			`obstacle_geometry must be one of "box", "obb", "hull_prism", "mesh", "sphere" or "capsule", got %q`, cfg.ObstacleGeometry)
+	}
+
+	if cfg.MaxPlanesToRemove < 0 {
+		return nil, optionalDeps, errors.New("max_planes_to_remove must be non-negative")
+	}
+
+	for _, o := range cfg.PlaneOrientations {
+		switch PlaneOrientation(o) {
+		case PlaneHorizontal, PlaneVertical, PlaneAny:
+		default:
+			return nil, optionalDeps, errors.Errorf(`plane_orientations must be "horizontal", "vertical" or "any", got %q`, o)
+		}
+	}
+
+	if cfg.PlaneAngleTolerance < 0 || cfg.PlaneAngleTolerance > 90 {
+		return nil, optionalDeps, errors.New("plane_angle_tolerance_degs must be between 0 and 90")
+	}
+
+	switch GroundSegmentation(cfg.GroundSegmentation) {
+	case "", GroundPlane, GroundZones:
+	default:
+		return nil, optionalDeps, errors.Errorf(`ground_segmentation must be "plane" or "zones", got %q`, cfg.GroundSegmentation)
+	}
+
+	if cfg.GroundZoneSize < 0 {
+		return nil, optionalDeps, errors.New("ground_zone_size_mm must be non-negative")
+	}
+
+	// the drops are measured from one ground plane, the ground of lower zones would be drops
+	if cfg.NegativeObstacles && GroundSegmentation(cfg.GroundSegmentation) == GroundZones {
+		return nil, optionalDeps, errors.New(`negative_obstacles cannot be used with ground_segmentation "zones"`)
+	}
+
+	if cfg.NegativeObstacleDepth < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_depth_mm must be non-negative")
+	}
+
+	if cfg.NegativeObstacleMaxGap < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_max_gap_mm must be non-negative")
+	}
+
+	if cfg.NegativeObstacleResolution < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_resolution_mm must be non-negative")
+	}
+
+	if cfg.NegativeObstacleExtent < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_extent_mm must be non-negative")
+	}
+
+	if cfg.VoxelSize < 0 {
+		return nil, optionalDeps, errors.New("voxel_size_mm must be non-negative")
+	}
+
+	switch VoxelMode(cfg.VoxelMode) {
+	case "", VoxelCentroid, VoxelFirst:
+	default:
+		return nil, optionalDeps, errors.Errorf(`voxel_mode must be "centroid" or "first", got %q`, cfg.VoxelMode)
+	}
+
+	if cfg.StatisticalOutlierNeighbors < 0 {
+		return nil, optionalDeps, errors.New("statistical_outlier_neighbors must be non-negative")
+	}
+
+	if cfg.StatisticalOutlierStdDev < 0 {
+		return nil, optionalDeps, errors.New("statistical_outlier_std_dev must be non-negative")
+	}
+
+	if cfg.RadiusOutlierRadius < 0 {
+		return nil, optionalDeps, errors.New("radius_outlier_radius_mm must be non-negative")
+	}
+
+	if cfg.RadiusOutlierMinNeighbors < 0 {
+		return nil, optionalDeps, errors.New("radius_outlier_min_neighbors must be non-negative")
+	}
+
+	if err := cfg.RangeAdaptiveClustering.Validate(); err != nil {
+		return nil, optionalDeps, err
+	}
+
+	switch ClusteringMode(cfg.ClusteringMode) {
+	case "", ClusteringGrid, ClusteringRangeImage:
+	default:
+		return nil, optionalDeps, errors.Errorf(`clustering_mode must be "grid" or "range_image", got %q`, cfg.ClusteringMode)
+	}
+
+	if cfg.RangeImageVerticalResolution < 0 {
+		return nil, optionalDeps, errors.New("range_image_vertical_resolution_degs must be non-negative")
+	}
+
+	if cfg.RangeImageHorizontalResolution < 0 {
+		return nil, optionalDeps, errors.New("range_image_horizontal_resolution_degs must be non-negative")
+	}
+
+	if cfg.RangeImageAngleThreshold < 0 || cfg.RangeImageAngleThreshold >= 90 {
+		return nil, optionalDeps, errors.New("range_image_angle_threshold_degs must be between 0 and 90")
+	}
+
+	if cfg.MaxProcessingTime < 0 {
+		return nil, optionalDeps, errors.New("max_processing_time_ms must be non-negative")
+	}
+
+	if cfg.FusionHitProbability != 0 && (cfg.FusionHitProbability <= 0.5 || cfg.FusionHitProbability >= 1) {
+		return nil, optionalDeps, errors.New("fusion_hit_probability must be between 0.5 and 1")
+	}
+
+	if cfg.FusionMissProbability < 0 || cfg.FusionMissProbability >= 0.5 {
+		return nil, optionalDeps, errors.New("fusion_miss_probability must be between 0 and 0.5")
+	}
+
+	if cfg.FusionOccupiedProbability < 0 || cfg.FusionOccupiedProbability >= 1 {
+		return nil, optionalDeps, errors.New("fusion_occupied_probability must be between 0 and 1")
+	}
+
+	if cfg.FusionHalfLife < 0 {
+		return nil, optionalDeps, errors.New("fusion_half_life_ms must be non-negative")
+	}
+
+	if cfg.FusionResolution < 0 {
+		return nil, optionalDeps, errors.New("fusion_resolution_mm must be non-negative")
+	}
+
+	if cfg.FusionExtent < 0 {
+		return nil, optionalDeps, errors.New("fusion_extent_mm must be non-negative")
+	}
+
+	if cfg.GroundPlaneCacheMinInlierRatio < 0 || cfg.GroundPlaneCacheMinInlierRatio > 1 {
+		return nil, optionalDeps, errors.New("ground_plane_cache_min_inlier_ratio must be between 0 and 1")
+	}
+
+	if cfg.GroundPlaneCacheMaxFrames < 0 {
+		return nil, optionalDeps, errors.New("ground_plane_cache_max_frames must be non-negative")
+	}
+
 	if cfg.AngleTolerance < 0 {
 		return nil, optionalDeps, errors.New("ground_angle_tolerance_degs must be non-negative")
 	}
 
+	if cfg.RegionOfInterest != nil {
+		roiDeps, err := cfg.RegionOfInterest.Validate()
+		if err != nil {
+			return nil, optionalDeps, err
+		}
+		deps = append(deps, roiDeps...)
+	}
+
+	if cfg.OutputFrame != "" && (cfg.RegionOfInterest == nil || cfg.RegionOfInterest.Frame == "") {
+		deps = append(deps, framesystem.PublicServiceName.String())
+	}
+
 	return deps, optionalDeps, nil
 }
 
@@ -101,29 +327,113 @@ func registerObstaclesDepth(
 	if conf == nil {
 		return nil, errors.New("config for obstacles_depth cannot be nil")
 	}
+	// the ground normal points up, -Y in the frame of the camera and +Z in an output frame of the frame system
+	normal := r3.Vector{X: 0, Y: -1, Z: 0}
+	if conf.OutputFrame != "" {
+		normal = r3.Vector{X: 0, Y: 0, Z: 1}
+	}
 	// build the clustering config
 	cfg := &ErCCLConfig{
-		MinPtsInPlane:        conf.MinPtsInPlane,
-		MinPtsInSegment:      conf.MinPtsInSegment,
-		MaxDistFromPlane:     conf.MaxDistFromPlane,
-		NormalVec:            r3.Vector{0, -1, 0},
-		AngleTolerance:       conf.AngleTolerance,
-		ClusteringRadius:     conf.ClusteringRadius,
-		ClusteringStrictness: conf.ClusteringStrictness,
+		MinPtsInPlane:                  conf.MinPtsInPlane,
+		MinPtsInSegment:                conf.MinPtsInSegment,
+		MaxDistFromPlane:               conf.MaxDistFromPlane,
+		NormalVec:                      normal,
+		AngleTolerance:                 conf.AngleTolerance,
+		ClusteringRadius:               conf.ClusteringRadius,
+		ClusteringStrictness:           conf.ClusteringStrictness,
+		ClusteringAlpha:                conf.ClusteringAlpha,
+		GridResolution:                 conf.GridResolution,
+		GridCells:                      conf.GridCells,
+		ClusteringWorkers:              conf.ClusteringWorkers,
+		MaxProcessingTime:              conf.MaxProcessingTime,
+		Neighborhood:                   Neighborhood(conf.Neighborhood),
+		ObstacleGeometry:               ObstacleGeometry(conf.ObstacleGeometry),
+		MaxPlanesToRemove:              conf.MaxPlanesToRemove,
+		PlaneOrientations:              planeOrientations(conf.PlaneOrientations),
+		PlaneAngleTolerance:            conf.PlaneAngleTolerance,
+		GroundSegmentation:             GroundSegmentation(conf.GroundSegmentation),
+		GroundZoneSize:                 conf.GroundZoneSize,
+		NegativeObstacles:              conf.NegativeObstacles,
+		NegativeObstacleDepth:          conf.NegativeObstacleDepth,
+		NegativeObstacleMaxGap:         conf.NegativeObstacleMaxGap,
+		NegativeObstacleResolution:     conf.NegativeObstacleResolution,
+		NegativeObstacleExtent:         conf.NegativeObstacleExtent,
+		VoxelSize:                      conf.VoxelSize,
+		VoxelMode:                      VoxelMode(conf.VoxelMode),
+		FullResolutionObjects:          conf.FullResolutionObjects,
+		StatisticalOutlierRemoval:      conf.StatisticalOutlierRemoval,
+		StatisticalOutlierNeighbors:    conf.StatisticalOutlierNeighbors,
+		StatisticalOutlierStdDev:       conf.StatisticalOutlierStdDev,
+		RadiusOutlierRemoval:           conf.RadiusOutlierRemoval,
+		RadiusOutlierRadius:            conf.RadiusOutlierRadius,
+		RadiusOutlierMinNeighbors:      conf.RadiusOutlierMinNeighbors,
+		RangeAdaptiveClustering:        conf.RangeAdaptiveClustering,
+		ClusteringMode:                 ClusteringMode(conf.ClusteringMode),
+		RangeImageVerticalResolution:   conf.RangeImageVerticalResolution,
+		RangeImageHorizontalResolution: conf.RangeImageHorizontalResolution,
+		RangeImageAngleThreshold:       conf.RangeImageAngleThreshold,
 	}
 	cfg.SetDefaultValues()
 	myObsDep := &obsDepth{
 		clusteringConf: cfg,
+		pipeline:       &pipeline{cfg: cfg},
+	}
+	if conf.TemporalFusion {
+		myObsDep.pipeline.fusion = newFusionGrid(FusionConfig{
+			HitProbability:      conf.FusionHitProbability,
+			MissProbability:     conf.FusionMissProbability,
+			OccupiedProbability: conf.FusionOccupiedProbability,
+			HalfLife:            conf.FusionHalfLife,
+			Resolution:          conf.FusionResolution,
+			Extent:              conf.FusionExtent,
+			Anchored:            conf.OutputFrame != "",
+		})
+	}
+	if conf.OutputFrame != "" {
+		output, err := newOutputFrame(conf.OutputFrame, deps)
+		if err != nil {
+			return nil, err
+		}
+		myObsDep.pipeline.output = output
 	}
+	if conf.RegionOfInterest != nil {
+		roi, err := newRegionOfInterest(conf.RegionOfInterest, cfg.NormalVec, myObsDep.pipeline.output, deps)
+		if err != nil {
+			return nil, err
+		}
+		myObsDep.pipeline.roi = roi
+	}
+	if conf.GroundPlaneCache {
+		myObsDep.pipeline.planes = newPlaneCache(conf.GroundPlaneCacheMinInlierRatio, conf.GroundPlaneCacheMaxFrames)
+	}
+	var cam camera.Camera
 	if conf.DefaultCamera != "" {
-		_, err := camera.FromProvider(deps, conf.DefaultCamera)
+		var err error
+		cam, err = camera.FromProvider(deps, conf.DefaultCamera)
 		if err != nil {
 			return nil, errors.Errorf("could not find camera %q", conf.DefaultCamera)
 		}
 	}
 
 	segmenter := myObsDep.buildObsDepth(logger) // does the thing
-	return svision.NewService(name, deps, logger, nil, nil, nil, segmenter, conf.DefaultCamera)
+	svc := &obstaclesService{
+		pipeline: myObsDep.pipeline,
+		camera:   conf.DefaultCamera,
+		nextCloud: func(ctx context.Context) (pc.PointCloud, error) {
+			if cam == nil {
+				return nil, errors.New("no default camera to get depth maps from")
+			}
+			return myObsDep.pointCloud(ctx, cam)
+		},
+		occupancyResolution: OccupancyGridResolutionDefault,
+		occupancyExtent:     OccupancyGridExtentDefault,
+	}
+	var err error
+	svc.Service, err = svision.NewService(name, deps, logger, nil, nil, nil, segmenter, conf.DefaultCamera)
+	if err != nil {
+		return nil, err
+	}
+	return svc, nil
 }
 
 // BuildObsDepth will check for intrinsics and determine how to build based on that.
@@ -139,12 +449,13 @@ func (o *obsDepth) buildObsDepth(logger logging.Logger) func(
 			logger.CWarn(ctx, "obstacles depth started but camera did not have intrinsic parameters")
 			return o.obsDepthNoIntrinsics(ctx, src)
 		}
-		o.intrinsics = props.IntrinsicParams
+		o.setIntrinsics(props.IntrinsicParams)
 		return o.obsDepthWithIntrinsics(ctx, src)
 	}
 }
 
-// buildObsDepthNoIntrinsics will return the median depth in the depth map as a Geometry point.
+// buildObsDepthNoIntrinsics will return the median depth in the depth map as a Geometry point, in front of the
+// camera.
 func (o *obsDepth) obsDepthNoIntrinsics(ctx context.Context, src camera.Camera) ([]*vision.Object, error) {
 	img, err := camera.DecodeImageFromCamera(ctx, src, nil, nil)
 	if err != nil {
@@ -164,7 +475,18 @@ func (o *obsDepth) obsDepthNoIntrinsics(ctx context.Context, src camera.Camera)
 		return depData[i] < depData[j]
 	})
 	med := int(0.5 * float64(len(depData)))
-	pt := spatialmath.NewPoint(r3.Vector{X: 0, Y: 0, Z: float64(depData[med])}, "")
+	// the point is labeled with the frame it is expressed in, the output frame if there is one
+	center := r3.Vector{X: 0, Y: 0, Z: float64(depData[med])}
+	frame := src.Name().ShortName()
+	if o.pipeline.output != nil {
+		pose, err := o.pipeline.output.pose(ctx, frame)
+		if err != nil {
+			return nil, err
+		}
+		center = poseTransform(pose)(center)
+		frame = o.pipeline.output.name
+	}
+	pt := spatialmath.NewPoint(center, frameLabel(frame, ""))
 	toReturn := make([]*vision.Object, 1)
 	toReturn[0] = &vision.Object{Geometry: pt}
 	return toReturn, nil
@@ -174,9 +496,31 @@ func (o *obsDepth) obsDepthNoIntrinsics(ctx context.Context, src camera.Camera)
 // before clustering and projecting those points into 3D obstacles.
 func (o *obsDepth) obsDepthWithIntrinsics(ctx context.Context, src camera.Camera) ([]*vision.Object, error) {
 	// Check if we have intrinsics here. If not, don't even try
-	if o.intrinsics == nil {
+	if o.cameraIntrinsics() == nil {
 		return nil, errors.New("tried to build obstacles depth with intrinsics but no instrinsics found")
 	}
+	cloud, err := o.pointCloud(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	return o.pipeline.run(ctx, src.Name().ShortName(), cloud)
+}
+
+// pointCloud projects the next depth map of src to a point cloud, with the intrinsics of src if they are
+// not known yet.
+func (o *obsDepth) pointCloud(ctx context.Context, src camera.Camera) (pc.PointCloud, error) {
+	intrinsics := o.cameraIntrinsics()
+	if intrinsics == nil {
+		props, err := src.Properties(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not find camera properties")
+		}
+		if props.IntrinsicParams == nil {
+			return nil, errors.New("camera does not have intrinsic parameters")
+		}
+		intrinsics = props.IntrinsicParams
+		o.setIntrinsics(intrinsics)
+	}
 	img, err := camera.DecodeImageFromCamera(ctx, src, nil, nil)
 	if err != nil {
 		return nil, errors.Errorf("could not get image from %s", src)
@@ -185,6 +529,19 @@ func (o *obsDepth) obsDepthWithIntrinsics(ctx context.Context, src camera.Camera
 	if err != nil {
 		return nil, errors.New("could not convert image to depth map")
 	}
-	cloud := depthadapter.ToPointCloud(dm, o.intrinsics)
-	return ApplyERCCLToPointCloud(ctx, cloud, o.clusteringConf)
+	return depthadapter.ToPointCloud(dm, intrinsics), nil
+}
+
+// cameraIntrinsics returns the intrinsics of the camera, nil if they are not known yet.
+func (o *obsDepth) cameraIntrinsics() *transform.PinholeCameraIntrinsics {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.intrinsics
+}
+
+// setIntrinsics sets the intrinsics of the camera.
+func (o *obsDepth) setIntrinsics(intrinsics *transform.PinholeCameraIntrinsics) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.intrinsics = intrinsics
 }
@@ -2,17 +2,22 @@ package obstaclespointcloud
 
 import (
 	"context"
+	"sync"
 	"testing"
 
 	"github.com/pkg/errors"
 	"go.viam.com/test"
 
 	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
 	"go.viam.com/rdk/logging"
 	pc "go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/rimage"
+	"go.viam.com/rdk/rimage/transform"
 	"go.viam.com/rdk/services/vision"
 	"go.viam.com/rdk/testutils/inject"
+	rutils "go.viam.com/rdk/utils"
 )
 
 func TestObstaclesDepthRegistration(t *testing.T) {
@@ -70,3 +75,42 @@ func TestObstaclesDepthRegistration(t *testing.T) {
 	test.That(t, err, test.ShouldNotBeNil)
 	test.That(t, err.Error(), test.ShouldContainSubstring, "could not find camera \"not-camera\"")
 }
+
+func TestObstaclesDepthConcurrentIntrinsics(t *testing.T) {
+	dm := rimage.NewEmptyDepthMap(20, 20)
+	for x := range 20 {
+		for y := range 20 {
+			dm.Set(x, y, rimage.Depth(1000))
+		}
+	}
+	cam := inject.NewCamera("fakeCamera")
+	cam.ImagesFunc = func(
+		ctx context.Context, _ []string, _ map[string]interface{},
+	) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, err := camera.NamedImageFromImage(dm, "", rutils.MimeTypeRawDepth, data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{}, err
+	}
+	cam.PropertiesFunc = func(ctx context.Context) (camera.Properties, error) {
+		intrinsics := &transform.PinholeCameraIntrinsics{Width: 20, Height: 20, Fx: 20, Fy: 20, Ppx: 10, Ppy: 10}
+		return camera.Properties{IntrinsicParams: intrinsics}, nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObsDepthConfig{DefaultCamera: "fakeCamera"}
+	service, err := registerObstaclesDepth(context.Background(), vision.Named("test_depth"), params, deps, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+
+	// the intrinsics are set by both calls, which the race detector checks
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			_, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+			test.That(t, err, test.ShouldBeNil)
+		})
+		wg.Go(func() {
+			// a wall in front of the camera has no ground plane, only the projection matters here
+			_, err := service.DoCommand(context.Background(), map[string]interface{}{"command": "calibrate_extrinsics", "frames": 1.})
+			test.That(t, err.Error(), test.ShouldContainSubstring, "no ground plane")
+		})
+	}
+	wg.Wait()
+}
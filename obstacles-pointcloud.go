@@ -4,6 +4,7 @@ package obstaclespointcloud
 
 import (
 	"context"
+	"slices"
 
 	"github.com/golang/geo/r3"
 	"github.com/pkg/errors"
@@ -11,9 +12,10 @@ import (
 
 	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
+	pc "go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/robot/framesystem"
 	"go.viam.com/rdk/services/vision"
-	"go.viam.com/rdk/vision/segmentation"
 )
 
 var ObstaclesPointCloud = resource.NewModel("viam", "obstacles-pointcloud", "obstacles-pointcloud")
@@ -39,23 +41,94 @@ type NormalVec struct {
 }
 
 type ObstaclesPointCloudConfig struct {
-	MinPtsInPlane        int       `json:"min_points_in_plane"`
-	MinPtsInSegment      int       `json:"min_points_in_segment"`
-	MaxDistFromPlane     float64   `json:"max_dist_from_plane_mm"`
-	ClusteringRadius     int       `json:"clustering_radius"`
-	ClusteringStrictness float64   `json:"clustering_strictness"`
-	AngleTolerance       float64   `json:"ground_angle_tolerance_degs"`
-	DefaultCamera        string    `json:"camera_name"`
-	GroundPlaneNormalVec NormalVec `json:"ground_plane_normal_vec"`
+	MinPtsInPlane                  int               `json:"min_points_in_plane"`
+	MinPtsInSegment                int               `json:"min_points_in_segment"`
+	MaxDistFromPlane               float64           `json:"max_dist_from_plane_mm"`
+	ClusteringRadius               int               `json:"clustering_radius"`
+	ClusteringStrictness           float64           `json:"clustering_strictness"`
+	ClusteringAlpha                float64           `json:"clustering_alpha"`
+	GridResolution                 float64           `json:"grid_resolution_mm"`
+	GridCells                      int               `json:"grid_cells"`
+	ClusteringWorkers              int               `json:"clustering_workers"`
+	MaxProcessingTime              int               `json:"max_processing_time_ms"`
+	Neighborhood                   string            `json:"clustering_neighborhood"`
+	ObstacleGeometry               string            `json:"obstacle_geometry"`
+	MaxPlanesToRemove              int               `json:"max_planes_to_remove"`
+	PlaneOrientations              []string          `json:"plane_orientations"`
+	PlaneAngleTolerance            float64           `json:"plane_angle_tolerance_degs"`
+	GroundSegmentation             string            `json:"ground_segmentation"`
+	GroundZoneSize                 float64           `json:"ground_zone_size_mm"`
+	NegativeObstacles              bool              `json:"negative_obstacles"`
+	NegativeObstacleDepth          float64           `json:"negative_obstacle_depth_mm"`
+	NegativeObstacleMaxGap         float64           `json:"negative_obstacle_max_gap_mm"`
+	NegativeObstacleResolution     float64           `json:"negative_obstacle_resolution_mm"`
+	NegativeObstacleExtent         float64           `json:"negative_obstacle_extent_mm"`
+	VoxelSize                      float64           `json:"voxel_size_mm"`
+	VoxelMode                      string            `json:"voxel_mode"`
+	FullResolutionObjects          bool              `json:"full_resolution_objects"`
+	StatisticalOutlierRemoval      bool              `json:"statistical_outlier_removal"`
+	StatisticalOutlierNeighbors    int               `json:"statistical_outlier_neighbors"`
+	StatisticalOutlierStdDev       float64           `json:"statistical_outlier_std_dev"`
+	RadiusOutlierRemoval           bool              `json:"radius_outlier_removal"`
+	RadiusOutlierRadius            float64           `json:"radius_outlier_radius_mm"`
+	RadiusOutlierMinNeighbors      int               `json:"radius_outlier_min_neighbors"`
+	RangeAdaptiveClustering        RangeCurve        `json:"range_adaptive_clustering"`
+	ClusteringMode                 string            `json:"clustering_mode"`
+	RangeImageVerticalResolution   float64           `json:"range_image_vertical_resolution_degs"`
+	RangeImageHorizontalResolution float64           `json:"range_image_horizontal_resolution_degs"`
+	RangeImageAngleThreshold       float64           `json:"range_image_angle_threshold_degs"`
+	Tracking                       bool              `json:"tracking"`
+	TrackConfirmHits               int               `json:"track_confirm_hits"`
+	TrackMaxMisses                 int               `json:"track_max_misses"`
+	TrackMaxDistance               float64           `json:"track_max_distance_mm"`
+	TrackProcessNoise              float64           `json:"track_process_noise"`
+	TrackMeasurementNoise          float64           `json:"track_measurement_noise_mm"`
+	OccupancyGridResolution        float64           `json:"occupancy_grid_resolution_mm"`
+	OccupancyGridExtent            float64           `json:"occupancy_grid_extent_mm"`
+	TemporalFusion                 bool              `json:"temporal_fusion"`
+	FusionHitProbability           float64           `json:"fusion_hit_probability"`
+	FusionMissProbability          float64           `json:"fusion_miss_probability"`
+	FusionOccupiedProbability      float64           `json:"fusion_occupied_probability"`
+	FusionHalfLife                 int               `json:"fusion_half_life_ms"`
+	FusionResolution               float64           `json:"fusion_resolution_mm"`
+	FusionExtent                   float64           `json:"fusion_extent_mm"`
+	GroundPlaneCache               bool              `json:"ground_plane_cache"`
+	GroundPlaneCacheMinInlierRatio float64           `json:"ground_plane_cache_min_inlier_ratio"`
+	GroundPlaneCacheMaxFrames      int               `json:"ground_plane_cache_max_frames"`
+	RegionOfInterest               *RegionOfInterest `json:"region_of_interest"`
+	OutputFrame                    string            `json:"output_frame"`
+	AngleTolerance                 float64           `json:"ground_angle_tolerance_degs"`
+	DefaultCamera                  string            `json:"camera_name"`
+	CameraNames                    []string          `json:"camera_names"`
+	GroundPlaneNormalVec           NormalVec         `json:"ground_plane_normal_vec"`
 }
 
 func (cfg *ObstaclesPointCloudConfig) Validate(path string) ([]string, []string, error) {
 	var deps []string
 	var optionalDeps []string
-	if cfg.DefaultCamera == "" {
-		return nil, optionalDeps, errors.Errorf(`expected "camera_name" attribute (DefaultCamera) for obstacles pointcloud at %q`, path)
+	if cfg.DefaultCamera == "" && len(cfg.CameraNames) == 0 {
+		return nil, optionalDeps, errors.Errorf(
+			`expected "camera_name" attribute (DefaultCamera) or "camera_names" for obstacles pointcloud at %q`, path)
+	}
+	if cfg.DefaultCamera != "" {
+		deps = append(deps, cfg.DefaultCamera)
+	}
+
+	for i, name := range cfg.CameraNames {
+		if name == "" {
+			return nil, optionalDeps, errors.New("camera_names must not have empty names")
+		}
+		if slices.Contains(cfg.CameraNames[:i], name) {
+			return nil, optionalDeps, errors.Errorf("camera_names has %q more than once", name)
+		}
+		if name != cfg.DefaultCamera {
+			deps = append(deps, name)
+		}
+	}
+
+	if len(cfg.CameraNames) > 1 && cfg.OutputFrame == "" {
+		return nil, optionalDeps, errors.New("camera_names needs an output_frame to merge the point clouds in")
 	}
-	deps = append(deps, cfg.DefaultCamera)
 
 	if cfg.MinPtsInPlane < 0 {
 		return nil, optionalDeps, errors.New("min_points_in_plane must be positive")
@@ -77,10 +150,214 @@ func (cfg *ObstaclesPointCloudConfig) Validate(path string) ([]string, []string,
 		return nil, optionalDeps, errors.New("clustering_strictness must be non-negative")
 	}
 
+	if cfg.ClusteringAlpha < 0 || cfg.ClusteringAlpha > 1 {
+		return nil, optionalDeps, errors.New("clustering_alpha must be between 0 and 1")
+	}
+
+	if cfg.GridResolution < 0 {
+		return nil, optionalDeps, errors.New("grid_resolution_mm must be non-negative")
+	}
+
+	if cfg.GridCells < 0 {
+		return nil, optionalDeps, errors.New("grid_cells must be non-negative")
+	}
+
+	if cfg.GridResolution != 0 && cfg.GridCells != 0 {
+		return nil, optionalDeps, errors.New("only one of grid_resolution_mm and grid_cells can be set")
+	}
+
+	if cfg.ClusteringWorkers < 0 {
+		return nil, optionalDeps, errors.New("clustering_workers must be non-negative")
+	}
+
+	switch Neighborhood(cfg.Neighborhood) {
+	case "", NeighborhoodQuadrant, NeighborhoodSquare, NeighborhoodDisk:
+	default:
+		return nil, optionalDeps, errors.Errorf(`clustering_neighborhood must be one of "quadrant", "square" or "disk", got %q`, cfg.Neighborhood)
+	}
+
+	switch ObstacleGeometry(cfg.ObstacleGeometry) {
+	case "", GeometryBox, GeometryOBB, GeometryHullPrism, GeometryMesh, GeometrySphere, GeometryCapsule:
+	default:
+		return nil, optionalDeps, errors.Errorf(
+			`obstacle_geometry must be one of "box", "obb", "hull_prism", "mesh", "sphere" or "capsule", got %q`, cfg.ObstacleGeometry)
+	}
+
+	if cfg.MaxPlanesToRemove < 0 {
+		return nil, optionalDeps, errors.New("max_planes_to_remove must be non-negative")
+	}
+
+	for _, o := range cfg.PlaneOrientations {
+		switch PlaneOrientation(o) {
+		case PlaneHorizontal, PlaneVertical, PlaneAny:
+		default:
+			return nil, optionalDeps, errors.Errorf(`plane_orientations must be "horizontal", "vertical" or "any", got %q`, o)
+		}
+	}
+
+	if cfg.PlaneAngleTolerance < 0 || cfg.PlaneAngleTolerance > 90 {
+		return nil, optionalDeps, errors.New("plane_angle_tolerance_degs must be between 0 and 90")
+	}
+
+	switch GroundSegmentation(cfg.GroundSegmentation) {
+	case "", GroundPlane, GroundZones:
+	default:
+		return nil, optionalDeps, errors.Errorf(`ground_segmentation must be "plane" or "zones", got %q`, cfg.GroundSegmentation)
+	}
+
+	if cfg.GroundZoneSize < 0 {
+		return nil, optionalDeps, errors.New("ground_zone_size_mm must be non-negative")
+	}
+
+	// the drops are measured from one ground plane, the ground of lower zones would be drops
+	if cfg.NegativeObstacles && GroundSegmentation(cfg.GroundSegmentation) == GroundZones {
+		return nil, optionalDeps, errors.New(`negative_obstacles cannot be used with ground_segmentation "zones"`)
+	}
+
+	if cfg.NegativeObstacleDepth < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_depth_mm must be non-negative")
+	}
+
+	if cfg.NegativeObstacleMaxGap < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_max_gap_mm must be non-negative")
+	}
+
+	if cfg.NegativeObstacleResolution < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_resolution_mm must be non-negative")
+	}
+
+	if cfg.NegativeObstacleExtent < 0 {
+		return nil, optionalDeps, errors.New("negative_obstacle_extent_mm must be non-negative")
+	}
+
+	if cfg.VoxelSize < 0 {
+		return nil, optionalDeps, errors.New("voxel_size_mm must be non-negative")
+	}
+
+	switch VoxelMode(cfg.VoxelMode) {
+	case "", VoxelCentroid, VoxelFirst:
+	default:
+		return nil, optionalDeps, errors.Errorf(`voxel_mode must be "centroid" or "first", got %q`, cfg.VoxelMode)
+	}
+
+	if cfg.StatisticalOutlierNeighbors < 0 {
+		return nil, optionalDeps, errors.New("statistical_outlier_neighbors must be non-negative")
+	}
+
+	if cfg.StatisticalOutlierStdDev < 0 {
+		return nil, optionalDeps, errors.New("statistical_outlier_std_dev must be non-negative")
+	}
+
+	if cfg.RadiusOutlierRadius < 0 {
+		return nil, optionalDeps, errors.New("radius_outlier_radius_mm must be non-negative")
+	}
+
+	if cfg.RadiusOutlierMinNeighbors < 0 {
+		return nil, optionalDeps, errors.New("radius_outlier_min_neighbors must be non-negative")
+	}
+
+	if err := cfg.RangeAdaptiveClustering.Validate(); err != nil {
+		return nil, optionalDeps, err
+	}
+
+	switch ClusteringMode(cfg.ClusteringMode) {
+	case "", ClusteringGrid, ClusteringRangeImage:
+	default:
+		return nil, optionalDeps, errors.Errorf(`clustering_mode must be "grid" or "range_image", got %q`, cfg.ClusteringMode)
+	}
+
+	if cfg.RangeImageVerticalResolution < 0 {
+		return nil, optionalDeps, errors.New("range_image_vertical_resolution_degs must be non-negative")
+	}
+
+	if cfg.RangeImageHorizontalResolution < 0 {
+		return nil, optionalDeps, errors.New("range_image_horizontal_resolution_degs must be non-negative")
+	}
+
+	if cfg.RangeImageAngleThreshold < 0 || cfg.RangeImageAngleThreshold >= 90 {
+		return nil, optionalDeps, errors.New("range_image_angle_threshold_degs must be between 0 and 90")
+	}
+
+	if cfg.MaxProcessingTime < 0 {
+		return nil, optionalDeps, errors.New("max_processing_time_ms must be non-negative")
+	}
+
+	if cfg.TrackConfirmHits < 0 {
+		return nil, optionalDeps, errors.New("track_confirm_hits must be non-negative")
+	}
+
+	if cfg.TrackMaxMisses < 0 {
+		return nil, optionalDeps, errors.New("track_max_misses must be non-negative")
+	}
+
+	if cfg.TrackMaxDistance < 0 {
+		return nil, optionalDeps, errors.New("track_max_distance_mm must be non-negative")
+	}
+
+	if cfg.TrackProcessNoise < 0 {
+		return nil, optionalDeps, errors.New("track_process_noise must be non-negative")
+	}
+
+	if cfg.TrackMeasurementNoise < 0 {
+		return nil, optionalDeps, errors.New("track_measurement_noise_mm must be non-negative")
+	}
+
+	if cfg.OccupancyGridResolution < 0 {
+		return nil, optionalDeps, errors.New("occupancy_grid_resolution_mm must be non-negative")
+	}
+
+	if cfg.OccupancyGridExtent < 0 {
+		return nil, optionalDeps, errors.New("occupancy_grid_extent_mm must be non-negative")
+	}
+
+	if cfg.FusionHitProbability != 0 && (cfg.FusionHitProbability <= 0.5 || cfg.FusionHitProbability >= 1) {
+		return nil, optionalDeps, errors.New("fusion_hit_probability must be between 0.5 and 1")
+	}
+
+	if cfg.FusionMissProbability < 0 || cfg.FusionMissProbability >= 0.5 {
+		return nil, optionalDeps, errors.New("fusion_miss_probability must be between 0 and 0.5")
+	}
+
+	if cfg.FusionOccupiedProbability < 0 || cfg.FusionOccupiedProbability >= 1 {
+		return nil, optionalDeps, errors.New("fusion_occupied_probability must be between 0 and 1")
+	}
+
+	if cfg.FusionHalfLife < 0 {
+		return nil, optionalDeps, errors.New("fusion_half_life_ms must be non-negative")
+	}
+
+	if cfg.FusionResolution < 0 {
+		return nil, optionalDeps, errors.New("fusion_resolution_mm must be non-negative")
+	}
+
+	if cfg.FusionExtent < 0 {
+		return nil, optionalDeps, errors.New("fusion_extent_mm must be non-negative")
+	}
+
+	if cfg.GroundPlaneCacheMinInlierRatio < 0 || cfg.GroundPlaneCacheMinInlierRatio > 1 {
+		return nil, optionalDeps, errors.New("ground_plane_cache_min_inlier_ratio must be between 0 and 1")
+	}
+
+	if cfg.GroundPlaneCacheMaxFrames < 0 {
+		return nil, optionalDeps, errors.New("ground_plane_cache_max_frames must be non-negative")
+	}
+
 	if cfg.AngleTolerance < 0 {
 		return nil, optionalDeps, errors.New("ground_angle_tolerance_degs must be non-negative")
 	}
 
+	if cfg.RegionOfInterest != nil {
+		roiDeps, err := cfg.RegionOfInterest.Validate()
+		if err != nil {
+			return nil, optionalDeps, err
+		}
+		deps = append(deps, roiDeps...)
+	}
+
+	if cfg.OutputFrame != "" && (cfg.RegionOfInterest == nil || cfg.RegionOfInterest.Frame == "") {
+		deps = append(deps, framesystem.PublicServiceName.String())
+	}
+
 	return deps, optionalDeps, nil
 }
 
@@ -106,22 +383,129 @@ func registerPointCloudSegmenter(
 	}
 	// build the clustering config
 	cfg := &ErCCLConfig{
-		MinPtsInPlane:        conf.MinPtsInPlane,
-		MinPtsInSegment:      conf.MinPtsInSegment,
-		MaxDistFromPlane:     conf.MaxDistFromPlane,
-		NormalVec:            groundPlaneNormalVec,
-		AngleTolerance:       conf.AngleTolerance,
-		ClusteringRadius:     conf.ClusteringRadius,
-		ClusteringStrictness: conf.ClusteringStrictness,
-		DefaultCamera:        conf.DefaultCamera,
+		MinPtsInPlane:                  conf.MinPtsInPlane,
+		MinPtsInSegment:                conf.MinPtsInSegment,
+		MaxDistFromPlane:               conf.MaxDistFromPlane,
+		NormalVec:                      groundPlaneNormalVec,
+		AngleTolerance:                 conf.AngleTolerance,
+		ClusteringRadius:               conf.ClusteringRadius,
+		ClusteringStrictness:           conf.ClusteringStrictness,
+		ClusteringAlpha:                conf.ClusteringAlpha,
+		GridResolution:                 conf.GridResolution,
+		GridCells:                      conf.GridCells,
+		ClusteringWorkers:              conf.ClusteringWorkers,
+		MaxProcessingTime:              conf.MaxProcessingTime,
+		Neighborhood:                   Neighborhood(conf.Neighborhood),
+		ObstacleGeometry:               ObstacleGeometry(conf.ObstacleGeometry),
+		MaxPlanesToRemove:              conf.MaxPlanesToRemove,
+		PlaneOrientations:              planeOrientations(conf.PlaneOrientations),
+		PlaneAngleTolerance:            conf.PlaneAngleTolerance,
+		GroundSegmentation:             GroundSegmentation(conf.GroundSegmentation),
+		GroundZoneSize:                 conf.GroundZoneSize,
+		NegativeObstacles:              conf.NegativeObstacles,
+		NegativeObstacleDepth:          conf.NegativeObstacleDepth,
+		NegativeObstacleMaxGap:         conf.NegativeObstacleMaxGap,
+		NegativeObstacleResolution:     conf.NegativeObstacleResolution,
+		NegativeObstacleExtent:         conf.NegativeObstacleExtent,
+		VoxelSize:                      conf.VoxelSize,
+		VoxelMode:                      VoxelMode(conf.VoxelMode),
+		FullResolutionObjects:          conf.FullResolutionObjects,
+		StatisticalOutlierRemoval:      conf.StatisticalOutlierRemoval,
+		StatisticalOutlierNeighbors:    conf.StatisticalOutlierNeighbors,
+		StatisticalOutlierStdDev:       conf.StatisticalOutlierStdDev,
+		RadiusOutlierRemoval:           conf.RadiusOutlierRemoval,
+		RadiusOutlierRadius:            conf.RadiusOutlierRadius,
+		RadiusOutlierMinNeighbors:      conf.RadiusOutlierMinNeighbors,
+		RangeAdaptiveClustering:        conf.RangeAdaptiveClustering,
+		ClusteringMode:                 ClusteringMode(conf.ClusteringMode),
+		RangeImageVerticalResolution:   conf.RangeImageVerticalResolution,
+		RangeImageHorizontalResolution: conf.RangeImageHorizontalResolution,
+		RangeImageAngleThreshold:       conf.RangeImageAngleThreshold,
+		DefaultCamera:                  conf.DefaultCamera,
 	}
 	cfg.SetDefaultValues()
-	if conf.DefaultCamera != "" {
-		_, err := camera.FromProvider(deps, conf.DefaultCamera)
+	defaultCamera := conf.DefaultCamera
+	if defaultCamera == "" && len(conf.CameraNames) > 0 {
+		defaultCamera = conf.CameraNames[0]
+	}
+	var cam camera.Camera
+	if defaultCamera != "" {
+		var err error
+		cam, err = camera.FromProvider(deps, defaultCamera)
 		if err != nil {
-			return nil, errors.Errorf("could not find camera %q", conf.DefaultCamera)
+			return nil, errors.Errorf("could not find camera %q", defaultCamera)
+		}
+	}
+	var cameras []camera.Camera
+	if len(conf.CameraNames) > 1 {
+		for _, name := range conf.CameraNames {
+			c, err := camera.FromProvider(deps, name)
+			if err != nil {
+				return nil, errors.Errorf("could not find camera %q", name)
+			}
+			cameras = append(cameras, c)
 		}
 	}
-	segmenter := segmentation.Segmenter(cfg.ErCCLAlgorithm)
-	return vision.NewService(name, deps, logger, nil, nil, nil, segmenter, conf.DefaultCamera)
+	svc := &obstaclesService{
+		pipeline: &pipeline{cfg: cfg},
+		camera:   defaultCamera,
+		nextCloud: func(ctx context.Context) (pc.PointCloud, error) {
+			if cam == nil {
+				return nil, errors.New("no default camera to get point clouds from")
+			}
+			return cam.NextPointCloud(ctx, nil)
+		},
+		cameras:             cameras,
+		occupancyResolution: conf.OccupancyGridResolution,
+		occupancyExtent:     conf.OccupancyGridExtent,
+	}
+	if svc.occupancyResolution == 0 {
+		svc.occupancyResolution = OccupancyGridResolutionDefault
+	}
+	if svc.occupancyExtent == 0 {
+		svc.occupancyExtent = OccupancyGridExtentDefault
+	}
+	if conf.TemporalFusion {
+		svc.pipeline.fusion = newFusionGrid(FusionConfig{
+			HitProbability:      conf.FusionHitProbability,
+			MissProbability:     conf.FusionMissProbability,
+			OccupiedProbability: conf.FusionOccupiedProbability,
+			HalfLife:            conf.FusionHalfLife,
+			Resolution:          conf.FusionResolution,
+			Extent:              conf.FusionExtent,
+			Anchored:            conf.OutputFrame != "",
+		})
+	}
+	if conf.OutputFrame != "" {
+		output, err := newOutputFrame(conf.OutputFrame, deps)
+		if err != nil {
+			return nil, err
+		}
+		svc.pipeline.output = output
+	}
+	if conf.RegionOfInterest != nil {
+		roi, err := newRegionOfInterest(conf.RegionOfInterest, cfg.NormalVec, svc.pipeline.output, deps)
+		if err != nil {
+			return nil, err
+		}
+		svc.pipeline.roi = roi
+	}
+	if conf.GroundPlaneCache {
+		svc.pipeline.planes = newPlaneCache(conf.GroundPlaneCacheMinInlierRatio, conf.GroundPlaneCacheMaxFrames)
+	}
+	if conf.Tracking {
+		svc.pipeline.tracking = &TrackerConfig{
+			ConfirmHits:      conf.TrackConfirmHits,
+			MaxMisses:        conf.TrackMaxMisses,
+			MaxDistance:      conf.TrackMaxDistance,
+			ProcessNoise:     conf.TrackProcessNoise,
+			MeasurementNoise: conf.TrackMeasurementNoise,
+		}
+	}
+	var err error
+	svc.Service, err = vision.NewService(name, deps, logger, nil, nil, nil, svc.segment, defaultCamera)
+	if err != nil {
+		return nil, err
+	}
+	return svc, nil
 }
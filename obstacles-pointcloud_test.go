@@ -12,6 +12,7 @@ import (
 	"go.viam.com/rdk/logging"
 	pc "go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/robot/framesystem"
 	"go.viam.com/rdk/services/vision"
 	"go.viam.com/rdk/testutils/inject"
 )
@@ -118,3 +119,118 @@ func TestRadiusClusteringSegmentation(t *testing.T) {
 	test.That(t, err, test.ShouldNotBeNil)
 	test.That(t, err.Error(), test.ShouldContainSubstring, "does not implement")
 }
+
+func TestObstaclesPointCloudValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(cfg *ObstaclesPointCloudConfig)
+		// err is a part of the expected error, and deps the expected dependencies if there is no error
+		err  string
+		deps []string
+	}{
+		{
+			name: "defaults",
+			deps: []string{"fakeCamera"},
+		},
+		{
+			name:   "clustering alpha",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.ClusteringAlpha = 1.5 },
+			err:    "clustering_alpha",
+		},
+		{
+			name:   "grid resolution",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.GridResolution = -1 },
+			err:    "grid_resolution_mm",
+		},
+		{
+			name: "grid resolution and cells",
+			modify: func(cfg *ObstaclesPointCloudConfig) {
+				cfg.GridResolution = 20
+				cfg.GridCells = 100
+			},
+			err: "only one of",
+		},
+		{
+			name:   "obstacle geometry",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.ObstacleGeometry = "cone" },
+			err:    "obstacle_geometry",
+		},
+		{
+			name:   "track max misses",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.TrackMaxMisses = -1 },
+			err:    "track_max_misses",
+		},
+		{
+			name:   "fusion miss probability",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.FusionMissProbability = 0.6 },
+			err:    "fusion_miss_probability",
+		},
+		{
+			name:   "ground plane cache min inlier ratio",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.GroundPlaneCacheMinInlierRatio = 1.5 },
+			err:    "ground_plane_cache_min_inlier_ratio",
+		},
+		{
+			name:   "plane orientations",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.PlaneOrientations = []string{"vertical", "sideways"} },
+			err:    "plane_orientations",
+		},
+		{
+			name:   "ground segmentation",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.GroundSegmentation = "patches" },
+			err:    "ground_segmentation",
+		},
+		{
+			name: "negative obstacles with zones",
+			modify: func(cfg *ObstaclesPointCloudConfig) {
+				cfg.GroundSegmentation = string(GroundZones)
+				cfg.NegativeObstacles = true
+			},
+			err: "negative_obstacles",
+		},
+		{
+			name:   "negative obstacle depth",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.NegativeObstacleDepth = -1 },
+			err:    "negative_obstacle_depth_mm",
+		},
+		{
+			name:   "voxel mode",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.VoxelMode = "median" },
+			err:    "voxel_mode",
+		},
+		{
+			name:   "radius outlier radius",
+			modify: func(cfg *ObstaclesPointCloudConfig) { cfg.RadiusOutlierRadius = -1 },
+			err:    "radius_outlier_radius_mm",
+		},
+		{
+			name: "region of interest",
+			modify: func(cfg *ObstaclesPointCloudConfig) {
+				cfg.RegionOfInterest = &RegionOfInterest{X: []float64{1000, -1000}}
+			},
+			err: "x_mm",
+		},
+		{
+			name: "region of interest in a frame",
+			modify: func(cfg *ObstaclesPointCloudConfig) {
+				cfg.RegionOfInterest = &RegionOfInterest{X: []float64{-1000, 1000}, Frame: "world"}
+			},
+			deps: []string{"fakeCamera", framesystem.PublicServiceName.String()},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &ObstaclesPointCloudConfig{DefaultCamera: "fakeCamera"}
+			if tc.modify != nil {
+				tc.modify(cfg)
+			}
+			deps, _, err := cfg.Validate("path")
+			if tc.err != "" {
+				test.That(t, err, test.ShouldNotBeNil)
+				test.That(t, err.Error(), test.ShouldContainSubstring, tc.err)
+				return
+			}
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, deps, test.ShouldResemble, tc.deps)
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package obstaclespointcloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/vision"
+)
+
+// pipeline runs the ER-CCL pipeline of a service, and keeps what has to last across calls.
+type pipeline struct {
+	cfg *ErCCLConfig
+	// fusion is nil if temporal fusion is off
+	fusion *fusionGrid
+	// tracking is nil if tracking is off
+	tracking *TrackerConfig
+	// planes is nil if the ground plane cache is off
+	planes *planeCache
+	// roi is nil if the whole point clouds are segmented
+	roi *regionOfInterest
+	// output is nil if the point clouds are segmented in the frame of the camera
+	output *outputFrame
+
+	mu sync.Mutex
+	// last is the result of the last run of the pipeline, and runs the number of runs
+	last *erCCLResult
+	runs int
+	// trackers has a tracker for each camera, or for the merged cameras, created at their first call
+	trackers map[string]*tracker
+}
+
+// prepare crops the point cloud of camera source to the region of interest if there is one, then moves it to
+// the output frame if there is one. It returns the cloud and the position of the sensor in the frame of the cloud.
+func (p *pipeline) prepare(ctx context.Context, source string, cloud pc.PointCloud) (pc.PointCloud, r3.Vector, error) {
+	var err error
+	if p.roi != nil {
+		cloud, err = p.roi.crop(ctx, cloud, source)
+		if err != nil {
+			return nil, r3.Vector{}, err
+		}
+	}
+	var sensor r3.Vector
+	if p.output != nil {
+		cloud, sensor, err = p.output.transform(ctx, cloud, source)
+		if err != nil {
+			return nil, r3.Vector{}, err
+		}
+	}
+	return cloud, sensor, nil
+}
+
+// run runs the ER-CCL pipeline on a point cloud of the camera source and keeps its result for DoCommand.
+func (p *pipeline) run(ctx context.Context, source string, cloud pc.PointCloud) ([]*vision.Object, error) {
+	cloud, sensor, err := p.prepare(ctx, source, cloud)
+	if err != nil {
+		return nil, err
+	}
+	return p.segment(ctx, cloud, sensor, p.frame(source), source)
+}
+
+// runMerged runs the ER-CCL pipeline once on the point clouds of several cameras, merged in the output frame, so
+// the obstacles seen by more than one camera come back as one object. The sensor is taken to be at the mean
+// position of the cameras.
+func (p *pipeline) runMerged(ctx context.Context, sources []string, clouds []pc.PointCloud) ([]*vision.Object, error) {
+	if p.output == nil {
+		return nil, errors.New("the point clouds of several cameras can only be merged in an output_frame")
+	}
+	prepared := make([]pc.PointCloud, len(clouds))
+	var sensor r3.Vector
+	for i, cloud := range clouds {
+		var position r3.Vector
+		var err error
+		prepared[i], position, err = p.prepare(ctx, sources[i], cloud)
+		if err != nil {
+			return nil, err
+		}
+		sensor = sensor.Add(position)
+	}
+	merged, err := mergeClouds(ctx, prepared)
+	if err != nil {
+		return nil, err
+	}
+	return p.segment(ctx, merged, sensor.Mul(1/float64(len(clouds))), p.output.name, mergedSource(sources))
+}
+
+// mergedSource returns the name the tracks of the merged point clouds of cameras sources are kept under.
+func mergedSource(sources []string) string {
+	return strings.Join(sources, ",")
+}
+
+// frame returns the name of the frame the objects of camera source are expressed in, the output frame if there
+// is one.
+func (p *pipeline) frame(source string) string {
+	if p.output != nil {
+		return p.output.name
+	}
+	return source
+}
+
+// segment runs the ER-CCL pipeline on a prepared point cloud expressed in frame, and labels the objects with it.
+// The objects come from the fused grid if temporal fusion is on, and are matched to the tracks of source if tracking
+// is on.
+func (p *pipeline) segment(
+	ctx context.Context, cloud pc.PointCloud, sensor r3.Vector, frame, source string,
+) ([]*vision.Object, error) {
+	res, err := segmentERCCL(ctx, cloud, sensor, p.cfg, p.planes)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.last = res
+	p.runs++
+	p.mu.Unlock()
+	now := time.Now()
+	objects := res.objects
+	if p.fusion != nil {
+		objects, err = p.fusion.update(res, now, p.cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	labelFrame(objects, frame)
+	if tr := p.tracker(source, true); tr != nil {
+		return tr.update(objects, now), nil
+	}
+	return objects, nil
+}
+
+// tracker returns the tracker of the camera source, creating it if create is true. It returns nil if tracking is
+// off, or if source has no tracker and create is false.
+func (p *pipeline) tracker(source string, create bool) *tracker {
+	if p.tracking == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tr, ok := p.trackers[source]
+	if !ok && create {
+		if p.trackers == nil {
+			p.trackers = make(map[string]*tracker)
+		}
+		tr = newTracker(*p.tracking)
+		p.trackers[source] = tr
+	}
+	return tr
+}
+
+// lastResult returns the result of the last run of the pipeline.
+func (p *pipeline) lastResult() (*erCCLResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last == nil {
+		return nil, errors.New("no point cloud has been segmented yet")
+	}
+	return p.last, nil
+}
+
+// obstaclesService is the vision service of the obstacle models. It answers DoCommand about its pipeline.
+type obstaclesService struct {
+	svision.Service
+	pipeline *pipeline
+	// camera is the name of the default camera, and nextCloud returns its next point cloud, in its own frame,
+	// for the commands that need several frames
+	camera    string
+	nextCloud func(ctx context.Context) (pc.PointCloud, error)
+	// cameras are the cameras whose point clouds are merged, it is empty if each camera is segmented alone
+	cameras []camera.Camera
+	// occupancyResolution and occupancyExtent are the default size of the cells and of the occupancy grid in mm
+	occupancyResolution, occupancyExtent float64
+}
+
+// segment runs the pipeline on the next point cloud of src. If src is one of the merged cameras, it runs once on
+// the next point clouds of all of them.
+func (s *obstaclesService) segment(ctx context.Context, src camera.Camera) ([]*vision.Object, error) {
+	if s.merges(src.Name().ShortName()) {
+		clouds, err := nextClouds(ctx, s.cameras)
+		if err != nil {
+			return nil, err
+		}
+		return s.pipeline.runMerged(ctx, s.mergedSources(), clouds)
+	}
+	cloud, err := src.NextPointCloud(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.pipeline.run(ctx, src.Name().ShortName(), cloud)
+}
+
+// merges returns whether the camera named source is one of the cameras whose point clouds are merged.
+func (s *obstaclesService) merges(source string) bool {
+	for _, cam := range s.cameras {
+		if cam.Name().ShortName() == source {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedSources returns the names of the cameras whose point clouds are merged.
+func (s *obstaclesService) mergedSources() []string {
+	sources := make([]string, len(s.cameras))
+	for i, cam := range s.cameras {
+		sources[i] = cam.Name().ShortName()
+	}
+	return sources
+}
+
+// DoCommand answers the commands of the obstacle models, given by the "command" key:
+//   - "get_tracks" returns the confirmed tracks seen in the last call for the camera "camera_name", the default
+//     camera if it is not given, with their geometries and estimated velocities, when tracking is on.
+//   - "get_occupancy_grid" returns the occupancy grid of the last call, on the ground plane. The "resolution_mm"
+//     and "extent_mm" keys override the configured size of the cells and of the grid.
+//   - "get_ground_plane" returns the ground plane found in the last call. Its points are returned as a PCD too
+//     if "include_points" is true.
+//   - "get_planes" returns the planes removed in the last call, the ground plane first, with whether they are
+//     horizontal, vertical or inclined.
+//   - "get_stats" returns the number of point clouds segmented, and the hits and misses of the ground plane cache
+//     if it is on.
+//   - "calibrate_extrinsics" averages the ground plane over "frames" new frames of the default camera, and returns
+//     the height, pitch and roll of the camera above it, with a suggested pose for the frame system.
+func (s *obstaclesService) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	name, ok := cmd["command"].(string)
+	if !ok {
+		return nil, errors.New(`expected a "command" string`)
+	}
+	switch name {
+	case "get_tracks":
+		return s.getTracks(cmd)
+	case "get_occupancy_grid":
+		return s.getOccupancyGrid(cmd)
+	case "get_ground_plane":
+		return s.getGroundPlane(cmd)
+	case "get_planes":
+		return s.getPlanes()
+	case "get_stats":
+		return s.getStats(), nil
+	case "calibrate_extrinsics":
+		return s.calibrateExtrinsics(ctx, cmd)
+	default:
+		return nil, errors.Errorf("unknown command %q", name)
+	}
+}
+
+func (s *obstaclesService) getTracks(cmd map[string]interface{}) (map[string]interface{}, error) {
+	if s.pipeline.tracking == nil {
+		return nil, errors.New("tracking is not enabled")
+	}
+	source := s.camera
+	if name, ok := cmd["camera_name"].(string); ok {
+		source = name
+	}
+	if s.merges(source) {
+		source = mergedSource(s.mergedSources())
+	}
+	tracks := []interface{}{}
+	tr := s.pipeline.tracker(source, false)
+	if tr == nil {
+		return map[string]interface{}{"tracks": tracks}, nil
+	}
+	for _, t := range tr.confirmedTracks() {
+		geometry, err := geometryToMap(t.Geometry)
+		if err != nil {
+			return nil, err
+		}
+		covariance := make([]interface{}, 0, 36)
+		for _, row := range t.Covariance {
+			for _, c := range row {
+				covariance = append(covariance, c)
+			}
+		}
+		tracks = append(tracks, map[string]interface{}{
+			"id":         t.ID,
+			"label":      t.Label,
+			"age":        t.Age,
+			"hits":       t.Hits,
+			"center":     vectorToMap(t.Center),
+			"position":   vectorToMap(t.Position),
+			"velocity":   vectorToMap(t.Velocity),
+			"covariance": covariance,
+			"geometry":   geometry,
+		})
+	}
+	return map[string]interface{}{"tracks": tracks}, nil
+}
+
+func (s *obstaclesService) getOccupancyGrid(cmd map[string]interface{}) (map[string]interface{}, error) {
+	res, err := s.pipeline.lastResult()
+	if err != nil {
+		return nil, err
+	}
+	resolution, extent := s.occupancyResolution, s.occupancyExtent
+	if r, ok := cmd["resolution_mm"].(float64); ok {
+		resolution = r
+	}
+	if e, ok := cmd["extent_mm"].(float64); ok {
+		extent = e
+	}
+	grid, err := occupancyGridFromResult(res, resolution, extent)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"resolution_mm": grid.resolution,
+		"width":         grid.side,
+		"height":        grid.side,
+		"origin":        vectorToMap(grid.originInSensor()),
+		"x_axis":        vectorToMap(grid.ground.x),
+		"y_axis":        vectorToMap(grid.ground.y),
+		"ground_normal": vectorToMap(grid.ground.normal),
+		"encoding":      "uint8 row-major, rows along y_axis: 0 unknown, 1 free, 2 occupied",
+		"data":          base64.StdEncoding.EncodeToString(grid.cells),
+	}, nil
+}
+
+func (s *obstaclesService) getGroundPlane(cmd map[string]interface{}) (map[string]interface{}, error) {
+	res, err := s.pipeline.lastResult()
+	if err != nil {
+		return nil, err
+	}
+	if res.plane == nil {
+		return map[string]interface{}{"found": false}, nil
+	}
+	planeCloud, err := res.plane.PointCloud()
+	if err != nil {
+		return nil, err
+	}
+	normal, offset := planeEquation(res.plane, s.pipeline.cfg.NormalVec)
+	cos := normal.Dot(s.pipeline.cfg.NormalVec.Normalize())
+	resp := map[string]interface{}{
+		"found":        true,
+		"normal":       vectorToMap(normal),
+		"offset_mm":    offset,
+		"center":       vectorToMap(res.plane.Center()),
+		"inlier_count": planeCloud.Size(),
+		"angle_degs":   math.Acos(math.Min(1, cos)) * 180 / math.Pi,
+	}
+	if include, ok := cmd["include_points"].(bool); ok && include {
+		var buf bytes.Buffer
+		if err := pc.ToPCD(planeCloud, &buf, pc.PCDBinary); err != nil {
+			return nil, err
+		}
+		resp["pcd"] = base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+	return resp, nil
+}
+
+func (s *obstaclesService) getPlanes() (map[string]interface{}, error) {
+	res, err := s.pipeline.lastResult()
+	if err != nil {
+		return nil, err
+	}
+	planes := []interface{}{}
+	add := func(plane pc.Plane, kind string) error {
+		planeCloud, err := plane.PointCloud()
+		if err != nil {
+			return err
+		}
+		// the normals point to the camera
+		normal, offset := planeEquation(plane, res.ground.origin.Sub(plane.Center()))
+		cos := math.Abs(normal.Dot(res.ground.normal))
+		planes = append(planes, map[string]interface{}{
+			"kind":                 kind,
+			"normal":               vectorToMap(normal),
+			"offset_mm":            offset,
+			"center":               vectorToMap(plane.Center()),
+			"inlier_count":         planeCloud.Size(),
+			"angle_to_ground_degs": math.Acos(math.Min(1, cos)) * 180 / math.Pi,
+		})
+		return nil
+	}
+	if res.plane != nil {
+		if err := add(res.plane, planeKindGround); err != nil {
+			return nil, err
+		}
+	}
+	for _, plane := range res.extraPlanes {
+		if err := add(plane, planeKind(plane, res.ground.normal, s.pipeline.cfg.PlaneAngleTolerance)); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{"planes": planes}, nil
+}
+
+func (s *obstaclesService) getStats() map[string]interface{} {
+	s.pipeline.mu.Lock()
+	stats := map[string]interface{}{"segmentations": s.pipeline.runs}
+	s.pipeline.mu.Unlock()
+	if s.pipeline.planes != nil {
+		hits, misses := s.pipeline.planes.stats()
+		stats["ground_plane_cache_hits"] = hits
+		stats["ground_plane_cache_misses"] = misses
+	}
+	return stats
+}
+
+func (s *obstaclesService) calibrateExtrinsics(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	frames := CalibrationFramesDefault
+	if f, ok := cmd["frames"].(float64); ok {
+		frames = int(f)
+	}
+	if frames < 1 || frames > maxCalibrationFrames {
+		return nil, errors.Errorf("frames must be between 1 and %d", maxCalibrationFrames)
+	}
+	cfg := s.pipeline.cfg
+	if s.pipeline.output != nil {
+		// the ground normal is configured in the output frame, and the clouds are calibrated in the camera frame
+		normal, err := s.pipeline.output.directionInCamera(ctx, s.camera, cfg.NormalVec)
+		if err != nil {
+			return nil, err
+		}
+		cameraCfg := *cfg
+		cameraCfg.NormalVec = normal
+		cfg = &cameraCfg
+	}
+	ext, err := calibrateExtrinsics(ctx, s.nextCloud, cfg, frames)
+	if err != nil {
+		return nil, err
+	}
+	ov := ext.Pose.Orientation().OrientationVectorDegrees()
+	return map[string]interface{}{
+		"frames_used":       ext.FramesUsed,
+		"height_mm":         ext.Height,
+		"height_std_dev_mm": ext.HeightStdDev,
+		"pitch_degs":        ext.Pitch,
+		"roll_degs":         ext.Roll,
+		"up":                vectorToMap(ext.Up),
+		"suggested_pose": map[string]interface{}{
+			"translation": vectorToMap(ext.Pose.Point()),
+			"orientation": map[string]interface{}{
+				"type":  "ov_degrees",
+				"value": map[string]interface{}{"x": ov.OX, "y": ov.OY, "z": ov.OZ, "th": ov.Theta},
+			},
+		},
+	}, nil
+}
+
+// vectorToMap returns a vector as a map that can be sent back by DoCommand.
+func vectorToMap(v r3.Vector) map[string]interface{} {
+	return map[string]interface{}{"x": v.X, "y": v.Y, "z": v.Z}
+}
+
+// geometryToMap returns a geometry as a map that can be sent back by DoCommand, in the format of
+// its protobuf message.
+func geometryToMap(geometry spatialmath.Geometry) (map[string]interface{}, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(geometry.ToProtobuf())
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
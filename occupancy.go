@@ -0,0 +1,147 @@
+package obstaclespointcloud
+
+import (
+	"math"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// Default values of the occupancy grid.
+const (
+	OccupancyGridResolutionDefault = 50.
+	OccupancyGridExtentDefault     = 10000.
+	// maxOccupancyGridSide is the largest number of cells along a side of an occupancy grid.
+	maxOccupancyGridSide = 4096
+)
+
+// The states of the cells of an occupancy grid.
+const (
+	OccupancyUnknown byte = iota
+	OccupancyFree
+	OccupancyOccupied
+)
+
+// occupancyGrid is a square grid on the ground plane, centered below the sensor, where each cell is either
+// free (it has ground points), occupied (it has obstacle points), or unknown (it has neither).
+type occupancyGrid struct {
+	ground     groundFrame
+	resolution float64
+	side       int
+	// origin is the corner of the first cell in the ground frame, its Z is the height of the ground
+	origin r3.Vector
+	// cells are row by row, rows along the Y axis of the ground frame and columns along its X axis
+	cells []byte
+}
+
+// newOccupancyGrid returns an empty grid of cells of resolution mm covering extent mm on each side.
+func newOccupancyGrid(ground groundFrame, groundHeight, resolution, extent float64) (*occupancyGrid, error) {
+	if resolution <= 0 || extent <= 0 {
+		return nil, errors.New("the resolution and extent of an occupancy grid must be positive")
+	}
+	side := int(math.Ceil(extent / resolution))
+	if side > maxOccupancyGridSide {
+		return nil, errors.Errorf("an occupancy grid of %v mm with cells of %v mm would have more than %d cells on a side",
+			extent, resolution, maxOccupancyGridSide)
+	}
+	half := float64(side) * resolution / 2
+	return &occupancyGrid{
+		ground:     ground,
+		resolution: resolution,
+		side:       side,
+		origin:     r3.Vector{X: -half, Y: -half, Z: groundHeight},
+		cells:      make([]byte, side*side),
+	}, nil
+}
+
+// occupancyGridFromResult returns the occupancy grid of a run of the ER-CCL pipeline. The cells with points of
+// the ground plane are free, and the cells with points of the obstacles that were found are occupied.
+func occupancyGridFromResult(res *erCCLResult, resolution, extent float64) (*occupancyGrid, error) {
+	groundHeight := 0.
+	if res.plane != nil {
+		groundHeight = res.ground.fromSensor(res.plane.Center()).Z
+	}
+	grid, err := newOccupancyGrid(res.ground, groundHeight, resolution, extent)
+	if err != nil {
+		return nil, err
+	}
+	if res.plane != nil {
+		planeCloud, err := res.plane.PointCloud()
+		if err != nil {
+			return nil, err
+		}
+		grid.mark(planeCloud, OccupancyFree)
+	}
+	for _, obj := range res.objects {
+		grid.mark(obj.PointCloud, OccupancyOccupied)
+	}
+	return grid, nil
+}
+
+// cell returns the index of the cell a point of the sensor frame falls into, or false if it is outside the grid.
+func (g *occupancyGrid) cell(p r3.Vector) (int, bool) {
+	q := g.ground.fromSensor(p)
+	col := int(math.Floor((q.X - g.origin.X) / g.resolution))
+	row := int(math.Floor((q.Y - g.origin.Y) / g.resolution))
+	if col < 0 || row < 0 || col >= g.side || row >= g.side {
+		return 0, false
+	}
+	return row*g.side + col, true
+}
+
+// mark sets the state of the cells of the points, an occupied cell stays occupied.
+func (g *occupancyGrid) mark(cloud pc.PointCloud, state byte) {
+	if cloud == nil {
+		return
+	}
+	cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		if i, ok := g.cell(p); ok && g.cells[i] != OccupancyOccupied {
+			g.cells[i] = state
+		}
+		return true
+	})
+}
+
+// originInSensor returns the corner of the first cell in the sensor frame.
+func (g *occupancyGrid) originInSensor() r3.Vector {
+	return g.ground.toSensor(g.origin)
+}
+
+// cellCenter returns the X and Y of the center of cell i in the ground frame.
+func (g *occupancyGrid) cellCenter(i int) (float64, float64) {
+	row, col := i/g.side, i%g.side
+	return g.origin.X + (float64(col)+0.5)*g.resolution, g.origin.Y + (float64(row)+0.5)*g.resolution
+}
+
+// gridComponents returns the groups of cells of a square grid that are in and touch, including diagonally.
+func gridComponents(side int, in func(i int) bool) [][]int {
+	visited := make([]bool, side*side)
+	var components [][]int
+	for start := range visited {
+		if visited[start] || !in(start) {
+			continue
+		}
+		visited[start] = true
+		component := []int{start}
+		for k := 0; k < len(component); k++ {
+			row, col := component[k]/side, component[k]%side
+			for di := -1; di <= 1; di++ {
+				for dj := -1; dj <= 1; dj++ {
+					r, c := row+di, col+dj
+					if r < 0 || c < 0 || r >= side || c >= side {
+						continue
+					}
+					n := r*side + c
+					if !visited[n] && in(n) {
+						visited[n] = true
+						component = append(component, n)
+					}
+				}
+			}
+		}
+		components = append(components, component)
+	}
+	return components
+}
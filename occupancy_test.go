@@ -0,0 +1,102 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+)
+
+func TestOccupancyGrid(t *testing.T) {
+	normal := r3.Vector{X: 0, Y: -0.7, Z: 0.7}
+	cloud, _ := tiltedScene(t, normal)
+	cfg := &ErCCLConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		NormalVec:        normal,
+		ClusteringRadius: 10,
+	}
+	cfg.SetDefaultValues()
+	res, err := segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+
+	grid, err := occupancyGridFromResult(res, 10, 1000)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, grid.side, test.ShouldEqual, 100)
+	test.That(t, grid.cells, test.ShouldHaveLength, 100*100)
+	test.That(t, grid.origin.Z, test.ShouldAlmostEqual, 0, 1e-6)
+
+	// the scene is drawn in the ground frame of the normal, which is the one the grid is in
+	state := func(x, y float64) byte {
+		i, ok := grid.cell(grid.ground.toSensor(r3.Vector{X: x, Y: y}))
+		test.That(t, ok, test.ShouldBeTrue)
+		return grid.cells[i]
+	}
+	test.That(t, state(200, 200), test.ShouldEqual, OccupancyFree)
+	test.That(t, state(65, 65), test.ShouldEqual, OccupancyOccupied)
+	test.That(t, state(315, 315), test.ShouldEqual, OccupancyOccupied)
+	test.That(t, state(-300, -300), test.ShouldEqual, OccupancyUnknown)
+	_, ok := grid.cell(grid.ground.toSensor(r3.Vector{X: 600, Y: 0}))
+	test.That(t, ok, test.ShouldBeFalse)
+
+	_, err = occupancyGridFromResult(res, 0, 1000)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = occupancyGridFromResult(res, 1, 1e6)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "cells on a side")
+}
+
+func TestOccupancyGridCommand(t *testing.T) {
+	cam := &inject.Camera{}
+	cloud, _ := tiltedScene(t, r3.Vector{X: 0, Y: 0, Z: 1})
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return cloud, nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:           500,
+		MinPtsInSegment:         20,
+		MaxDistFromPlane:        5,
+		ClusteringRadius:        10,
+		OccupancyGridResolution: 20,
+		DefaultCamera:           "fakeCamera",
+	}
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_grid"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	cmd := map[string]interface{}{"command": "get_occupancy_grid"}
+	_, err = service.DoCommand(context.Background(), cmd)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no point cloud")
+
+	_, err = service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	resp, err := service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["resolution_mm"], test.ShouldEqual, 20)
+	test.That(t, resp["width"], test.ShouldEqual, 500)
+	data, err := base64.StdEncoding.DecodeString(resp["data"].(string))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, data, test.ShouldHaveLength, 500*500)
+	counts := make(map[byte]int)
+	for _, c := range data {
+		counts[c]++
+	}
+	test.That(t, counts[OccupancyFree], test.ShouldBeGreaterThan, 0)
+	test.That(t, counts[OccupancyOccupied], test.ShouldBeGreaterThan, 0)
+	test.That(t, counts[OccupancyUnknown], test.ShouldBeGreaterThan, 0)
+
+	// the size of the grid can be given with the command
+	cmd["resolution_mm"] = 100.
+	cmd["extent_mm"] = 1000.
+	resp, err = service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["width"], test.ShouldEqual, 10)
+	test.That(t, resp["height"], test.ShouldEqual, 10)
+}
@@ -0,0 +1,138 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang/geo/r3"
+	"gonum.org/v1/gonum/spatial/kdtree"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// Default values of the outlier removal filters.
+const (
+	StatisticalOutlierNeighborsDefault = 8
+	StatisticalOutlierStdDevDefault    = 1.
+	RadiusOutlierRadiusDefault         = 50.
+	RadiusOutlierMinNeighborsDefault   = 3
+)
+
+// pointIndex is a balanced k-d tree of the points of a cloud, to find the neighbors of a point.
+type pointIndex struct {
+	tree *kdtree.Tree
+}
+
+// newPointIndex returns the index of the points of cloud.
+func newPointIndex(ctx context.Context, cloud pc.PointCloud) (*pointIndex, error) {
+	points := make(kdtree.Points, 0, cloud.Size())
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		points = append(points, kdtree.Point{p.X, p.Y, p.Z})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pointIndex{tree: kdtree.New(points, false)}, nil
+}
+
+// meanNeighborDistance returns the mean distance from a point of the index to its k nearest neighbors.
+func (idx *pointIndex) meanNeighborDistance(p r3.Vector, k int) float64 {
+	// the point itself is its nearest neighbor
+	keep := kdtree.NewNKeeper(k + 1)
+	idx.tree.NearestSet(keep, kdtree.Point{p.X, p.Y, p.Z})
+	sum, count, self := 0., 0, false
+	for _, c := range keep.Heap {
+		if c.Comparable == nil {
+			continue
+		}
+		if c.Dist == 0 && !self {
+			self = true
+			continue
+		}
+		sum += math.Sqrt(c.Dist)
+		count++
+	}
+	if count == 0 {
+		return math.Inf(1)
+	}
+	return sum / float64(count)
+}
+
+// neighborsWithin returns the number of other points of the index within radius of a point of the index.
+func (idx *pointIndex) neighborsWithin(p r3.Vector, radius float64) int {
+	keep := kdtree.NewDistKeeper(radius * radius)
+	idx.tree.NearestSet(keep, kdtree.Point{p.X, p.Y, p.Z})
+	count := 0
+	for _, c := range keep.Heap {
+		if c.Comparable != nil {
+			count++
+		}
+	}
+	// the point itself is within the radius
+	return count - 1
+}
+
+// removeStatisticalOutliers drops the points whose mean distance to their k nearest neighbors is more than
+// stdDevs standard deviations above the mean of that distance over the cloud. These are the isolated points,
+// like the flying pixels of depth cameras along the edges of objects.
+func removeStatisticalOutliers(ctx context.Context, cloud pc.PointCloud, k int, stdDevs float64) (pc.PointCloud, error) {
+	if cloud.Size() <= k {
+		return cloud, nil
+	}
+	idx, err := newPointIndex(ctx, cloud)
+	if err != nil {
+		return nil, err
+	}
+	distances := make(map[r3.Vector]float64, cloud.Size())
+	err = iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		distances[p] = idx.meanNeighborDistance(p, k)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	mean, variance := 0., 0.
+	for _, d := range distances {
+		mean += d
+	}
+	mean /= float64(len(distances))
+	for _, d := range distances {
+		variance += (d - mean) * (d - mean)
+	}
+	threshold := mean + stdDevs*math.Sqrt(variance/float64(len(distances)))
+
+	return filterCloud(ctx, cloud, func(p r3.Vector) bool {
+		return distances[p] <= threshold
+	})
+}
+
+// removeRadiusOutliers drops the points that have fewer than minNeighbors other points within radius.
+func removeRadiusOutliers(ctx context.Context, cloud pc.PointCloud, radius float64, minNeighbors int) (pc.PointCloud, error) {
+	idx, err := newPointIndex(ctx, cloud)
+	if err != nil {
+		return nil, err
+	}
+	return filterCloud(ctx, cloud, func(p r3.Vector) bool {
+		return idx.neighborsWithin(p, radius) >= minNeighbors
+	})
+}
+
+// filterCloud returns the points of cloud that keep returns true for.
+func filterCloud(ctx context.Context, cloud pc.PointCloud, keep func(p r3.Vector) bool) (pc.PointCloud, error) {
+	filtered := pc.NewBasicPointCloud(cloud.Size())
+	var setErr error
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		if keep(p) {
+			setErr = filtered.Set(p, d)
+		}
+		return setErr == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if setErr != nil {
+		return nil, setErr
+	}
+	return filtered, nil
+}
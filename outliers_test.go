@@ -0,0 +1,66 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// flyingPixels returns a cube of points 10 mm apart, with isolated points trailing from its corner toward the
+// camera at the origin, like the flying pixels of a depth camera.
+func flyingPixels(t *testing.T) (pc.PointCloud, []r3.Vector) {
+	t.Helper()
+	cloud := pc.NewBasicEmpty()
+	for x := 0.; x < 100; x += 10 {
+		for y := 0.; y < 100; y += 10 {
+			for z := 1000.; z < 1100; z += 10 {
+				test.That(t, cloud.Set(r3.Vector{X: x, Y: y, Z: z}, pc.NewBasicData()), test.ShouldBeNil)
+			}
+		}
+	}
+	var strays []r3.Vector
+	for z := 900.; z > 500; z -= 100 {
+		stray := r3.Vector{X: z / 10, Y: z / 10, Z: z}
+		strays = append(strays, stray)
+		test.That(t, cloud.Set(stray, pc.NewBasicData()), test.ShouldBeNil)
+	}
+	return cloud, strays
+}
+
+func TestStatisticalOutlierRemoval(t *testing.T) {
+	cloud, strays := flyingPixels(t)
+	filtered, err := removeStatisticalOutliers(context.Background(), cloud, 8, 1)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, filtered.Size(), test.ShouldEqual, 1000)
+	for _, p := range strays {
+		_, ok := filtered.At(p.X, p.Y, p.Z)
+		test.That(t, ok, test.ShouldBeFalse)
+	}
+
+	// a cloud too small to have k neighbors is kept
+	small := pc.NewBasicEmpty()
+	test.That(t, small.Set(r3.Vector{}, pc.NewBasicData()), test.ShouldBeNil)
+	filtered, err = removeStatisticalOutliers(context.Background(), small, 8, 1)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, filtered.Size(), test.ShouldEqual, 1)
+}
+
+func TestRadiusOutlierRemoval(t *testing.T) {
+	cloud, strays := flyingPixels(t)
+	filtered, err := removeRadiusOutliers(context.Background(), cloud, 15, 3)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, filtered.Size(), test.ShouldEqual, 1000)
+	for _, p := range strays {
+		_, ok := filtered.At(p.X, p.Y, p.Z)
+		test.That(t, ok, test.ShouldBeFalse)
+	}
+
+	// the corners of the cube have exactly 3 neighbors 10 mm away
+	filtered, err = removeRadiusOutliers(context.Background(), cloud, 10, 4)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, filtered.Size(), test.ShouldEqual, 1000-8)
+}
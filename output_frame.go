@@ -0,0 +1,112 @@
+package obstaclespointcloud
+
+import (
+	"context"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/robot/framesystem"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/vision"
+)
+
+// outputFrame moves the point clouds of the cameras into a frame of the frame system before they are segmented,
+// so the objects are expressed in it.
+type outputFrame struct {
+	name string
+	// pose returns the pose of a camera in the frame
+	pose func(ctx context.Context, camera string) (spatialmath.Pose, error)
+}
+
+// newOutputFrame returns the output frame of the given name, which looks up the poses of the cameras in the
+// frame system of deps.
+func newOutputFrame(name string, deps resource.Dependencies) (*outputFrame, error) {
+	pose, err := framePose(deps, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "output_frame needs the frame system")
+	}
+	return &outputFrame{name: name, pose: pose}, nil
+}
+
+// transform returns the cloud of camera expressed in the output frame, and the position of the camera in it.
+func (f *outputFrame) transform(ctx context.Context, cloud pc.PointCloud, camera string) (pc.PointCloud, r3.Vector, error) {
+	pose, err := f.pose(ctx, camera)
+	if err != nil {
+		return nil, r3.Vector{}, err
+	}
+	toFrame := poseTransform(pose)
+	moved := pc.NewBasicPointCloud(cloud.Size())
+	var setErr error
+	err = iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		setErr = moved.Set(toFrame(p), d)
+		return setErr == nil
+	})
+	if err != nil {
+		return nil, r3.Vector{}, err
+	}
+	if setErr != nil {
+		return nil, r3.Vector{}, setErr
+	}
+	return moved, pose.Point(), nil
+}
+
+// directionInCamera returns the direction v of the output frame expressed in the frame of camera.
+func (f *outputFrame) directionInCamera(ctx context.Context, camera string, v r3.Vector) (r3.Vector, error) {
+	pose, err := f.pose(ctx, camera)
+	if err != nil {
+		return r3.Vector{}, err
+	}
+	// the rows of the rotation matrix are the axes of the camera frame in the output frame
+	rotation := pose.Orientation().RotationMatrix()
+	return r3.Vector{X: rotation.Row(0).Dot(v), Y: rotation.Row(1).Dot(v), Z: rotation.Row(2).Dot(v)}, nil
+}
+
+// labelFrame adds the name of the frame the objects are expressed in to the labels of their geometries, if the
+// frame has a name.
+func labelFrame(objects []*vision.Object, frame string) {
+	if frame == "" {
+		return
+	}
+	for _, o := range objects {
+		if o.Geometry != nil {
+			o.Geometry.SetLabel(frameLabel(frame, o.Geometry.Label()))
+		}
+	}
+}
+
+// frameLabel returns the label of a geometry expressed in frame.
+func frameLabel(frame, label string) string {
+	if label == "" {
+		return "frame:" + frame
+	}
+	return label + " frame:" + frame
+}
+
+// framePose returns a function that looks up the pose of a camera in frame, in the frame system of deps.
+func framePose(deps resource.Dependencies, frame string) (func(ctx context.Context, camera string) (spatialmath.Pose, error), error) {
+	fs, err := framesystem.FromDependencies(deps)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, camera string) (spatialmath.Pose, error) {
+		pif, err := fs.GetPose(ctx, camera, frame, nil, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not find the pose of %q in frame %q", camera, frame)
+		}
+		return pif.Pose(), nil
+	}, nil
+}
+
+// poseTransform returns the function that expresses a point of a frame in the parent frame the frame has
+// the given pose in.
+func poseTransform(pose spatialmath.Pose) func(p r3.Vector) r3.Vector {
+	// the rows of a spatialmath rotation matrix are the axes of the frame in the parent frame
+	rotation, translation := pose.Orientation().RotationMatrix(), pose.Point()
+	x, y, z := rotation.Row(0), rotation.Row(1), rotation.Row(2)
+	return func(p r3.Vector) r3.Vector {
+		return x.Mul(p.X).Add(y.Mul(p.Y)).Add(z.Mul(p.Z)).Add(translation)
+	}
+}
@@ -0,0 +1,146 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/referenceframe"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/rimage"
+	"go.viam.com/rdk/robot/framesystem"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/testutils/inject"
+	rutils "go.viam.com/rdk/utils"
+)
+
+// worldFrameSystem returns a frame system where the camera has the given pose in the world.
+func worldFrameSystem(t *testing.T, pose spatialmath.Pose) *inject.FrameSystemService {
+	t.Helper()
+	fs := inject.NewFrameSystemService("fs")
+	fs.GetPoseFunc = func(
+		ctx context.Context, componentName, destinationFrame string, _ []*referenceframe.LinkInFrame, _ map[string]interface{},
+	) (*referenceframe.PoseInFrame, error) {
+		test.That(t, componentName, test.ShouldEqual, "fakeCamera")
+		test.That(t, destinationFrame, test.ShouldEqual, "world")
+		return referenceframe.NewPoseInFrame(destinationFrame, pose), nil
+	}
+	return fs
+}
+
+func TestOutputFrame(t *testing.T) {
+	// the camera is 1 m above the ground of the world, tilted
+	pose := spatialmath.NewPose(r3.Vector{X: 200, Y: -300, Z: 1000},
+		&spatialmath.OrientationVectorDegrees{OX: 0.3, OY: 0.2, OZ: 1, Theta: 20})
+	toCamera := func(p r3.Vector) r3.Vector {
+		return spatialmath.Compose(spatialmath.PoseInverse(pose), spatialmath.NewPoseFromPoint(p)).Point()
+	}
+	box := r3.Vector{X: 500, Y: 400, Z: 100}
+	cloud := scene{
+		groundMin:  r3.Vector{X: -1000, Y: -1000},
+		groundMax:  r3.Vector{X: 1000, Y: 1000},
+		groundStep: 10,
+		boxes: []sceneBox{{
+			min:  box.Add(r3.Vector{X: -50, Y: -50, Z: -80}),
+			max:  box.Add(r3.Vector{X: 50, Y: 50, Z: 80}),
+			step: r3.Vector{X: 10, Y: 10, Z: 20},
+		}},
+		toSensor: toCamera,
+	}.cloud(t)
+	cam := inject.NewCamera("fakeCamera")
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return cloud, nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam, framesystem.PublicServiceName: worldFrameSystem(t, pose)}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 10,
+		GridResolution:   20,
+		OutputFrame:      "world",
+		DefaultCamera:    "fakeCamera",
+	}
+	deps2, _, err := params.Validate("path")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps2, test.ShouldResemble, []string{"fakeCamera", framesystem.PublicServiceName.String()})
+
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_output"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	objects, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+	center := pc.CloudCentroid(objects[0].PointCloud)
+	test.That(t, center.X, test.ShouldAlmostEqual, box.X, 1)
+	test.That(t, center.Y, test.ShouldAlmostEqual, box.Y, 1)
+	test.That(t, center.Z, test.ShouldAlmostEqual, box.Z, 1)
+	test.That(t, objects[0].Geometry.Label(), test.ShouldEqual, "frame:world")
+
+	resp, err := service.DoCommand(context.Background(), map[string]interface{}{"command": "get_ground_plane"})
+	test.That(t, err, test.ShouldBeNil)
+	normal := resp["normal"].(map[string]interface{})
+	test.That(t, normal["z"], test.ShouldAlmostEqual, 1, 1e-6)
+	test.That(t, resp["offset_mm"], test.ShouldAlmostEqual, 0, 1e-6)
+
+	// without output_frame the objects are labeled with the frame of the camera
+	params.OutputFrame = ""
+	service, err = registerPointCloudSegmenter(context.Background(), svision.Named("test_output"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	objects, err = service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+	test.That(t, objects[0].Geometry.Label(), test.ShouldEqual, "frame:fakeCamera")
+	params.OutputFrame = "world"
+
+	_, err = registerPointCloudSegmenter(context.Background(), svision.Named("test_output"), params,
+		resource.Dependencies{camera.Named("fakeCamera"): cam}, nil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "frame system")
+}
+
+func TestObstaclesDepthNoIntrinsicsFrame(t *testing.T) {
+	dm := rimage.NewEmptyDepthMap(10, 10)
+	for x := range 10 {
+		for y := range 10 {
+			dm.Set(x, y, rimage.Depth(1000))
+		}
+	}
+	cam := inject.NewCamera("fakeCamera")
+	cam.ImagesFunc = func(
+		ctx context.Context, _ []string, _ map[string]interface{},
+	) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, err := camera.NamedImageFromImage(dm, "", rutils.MimeTypeRawDepth, data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{}, err
+	}
+	cam.PropertiesFunc = func(ctx context.Context) (camera.Properties, error) {
+		return camera.Properties{}, nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObsDepthConfig{DefaultCamera: "fakeCamera"}
+	service, err := registerObstaclesDepth(context.Background(), svision.Named("test_depth"), params, deps, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	objects, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+	test.That(t, objects[0].Geometry.Label(), test.ShouldEqual, "frame:fakeCamera")
+
+	// the camera looks along +X of the world, 500 mm above its origin
+	pose := spatialmath.NewPose(r3.Vector{Z: 500}, &spatialmath.OrientationVectorDegrees{OX: 1})
+	deps[framesystem.PublicServiceName] = worldFrameSystem(t, pose)
+	params.OutputFrame = "world"
+	service, err = registerObstaclesDepth(context.Background(), svision.Named("test_depth"), params, deps, logging.NewTestLogger(t))
+	test.That(t, err, test.ShouldBeNil)
+	objects, err = service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+	test.That(t, objects[0].Geometry.Label(), test.ShouldEqual, "frame:world")
+	point := objects[0].Geometry.Pose().Point()
+	test.That(t, point.X, test.ShouldAlmostEqual, 1000, 1e-6)
+	test.That(t, point.Z, test.ShouldAlmostEqual, 500, 1e-6)
+}
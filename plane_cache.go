@@ -0,0 +1,97 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/vision/segmentation"
+)
+
+// Default values of the ground plane cache.
+const (
+	PlaneCacheMinInlierRatioDefault = 0.8
+	PlaneCacheMaxFramesDefault      = 30
+)
+
+// planeCache keeps the last ground plane found by RANSAC, and uses it again for the next frames as long as
+// it still fits them.
+type planeCache struct {
+	mu sync.Mutex
+	// minInlierRatio is the share of the points of a frame that have to be on the cached plane, relative to
+	// the share that was on it when RANSAC found it
+	minInlierRatio float64
+	// maxFrames is the number of frames after which RANSAC runs again even if the cached plane still fits
+	maxFrames int
+
+	equation [4]float64
+	// ratio is the share of the points that were on the plane when RANSAC found it, 0 if nothing is cached
+	ratio float64
+	// frames is the number of frames the cached plane was used for
+	frames int
+	// hits and misses count the frames the cached plane was used for and the frames RANSAC ran for
+	hits, misses int
+}
+
+// newPlaneCache returns an empty cache, with the defaults for the values that are not set.
+func newPlaneCache(minInlierRatio float64, maxFrames int) *planeCache {
+	if minInlierRatio <= 0 || minInlierRatio > 1 {
+		minInlierRatio = PlaneCacheMinInlierRatioDefault
+	}
+	if maxFrames <= 0 {
+		maxFrames = PlaneCacheMaxFramesDefault
+	}
+	return &planeCache{minInlierRatio: minInlierRatio, maxFrames: maxFrames}
+}
+
+// findGroundPlane is findGroundPlane with the cached plane tried first. RANSAC only runs if nothing is cached,
+// if the cached plane has been used for maxFrames frames, or if too few points of the cloud are on it.
+func (c *planeCache) findGroundPlane(
+	ctx context.Context, cloud pc.PointCloud, cfg *ErCCLConfig, deadline time.Time,
+) (pc.Plane, pc.PointCloud, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ratio > 0 && c.frames < c.maxFrames && cloud.Size() > 0 {
+		pts, data := segmentation.GetPointCloudPositions(cloud)
+		inliers := 0
+		for _, pt := range pts {
+			if math.Abs(planeDistance(c.equation, pt)) < cfg.MaxDistFromPlane {
+				inliers++
+			}
+		}
+		if inliers > cfg.MinPtsInPlane && float64(inliers)/float64(len(pts)) >= c.minInlierRatio*c.ratio {
+			plane, nonPlane, err := splitByPlane(ctx, pts, data, c.equation, inliers, cfg)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			c.frames++
+			c.hits++
+			return plane, nonPlane, false, nil
+		}
+	}
+
+	c.misses++
+	plane, nonPlane, capped, err := findGroundPlane(ctx, cloud, cfg, deadline)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	c.ratio, c.frames = 0, 0
+	if plane != nil {
+		planeCloud, err := plane.PointCloud()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		c.equation = plane.Equation()
+		c.ratio = float64(planeCloud.Size()) / float64(cloud.Size())
+	}
+	return plane, nonPlane, capped, nil
+}
+
+// stats returns the number of frames the cached plane was used for and the number of frames RANSAC ran for.
+func (c *planeCache) stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
@@ -0,0 +1,97 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+)
+
+func TestPlaneCache(t *testing.T) {
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MaxDistFromPlane: 5, NormalVec: r3.Vector{Z: 1}, AngleTolerance: 30}
+	cfg.SetDefaultValues()
+	cache := newPlaneCache(0, 3)
+	test.That(t, cache.minInlierRatio, test.ShouldEqual, PlaneCacheMinInlierRatioDefault)
+	find := func(cloud pc.PointCloud) (int, int) {
+		plane, nonPlane, _, err := cache.findGroundPlane(context.Background(), cloud, cfg, time.Time{})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, plane, test.ShouldNotBeNil)
+		planeCloud, err := plane.PointCloud()
+		test.That(t, err, test.ShouldBeNil)
+		return planeCloud.Size(), nonPlane.Size()
+	}
+
+	scene, _ := tiltedScene(t, r3.Vector{Z: 1})
+	inliers, outliers := find(scene)
+	test.That(t, inliers, test.ShouldEqual, 40*40)
+	test.That(t, outliers, test.ShouldEqual, scene.Size()-40*40)
+	hits, misses := cache.stats()
+	test.That(t, hits, test.ShouldEqual, 0)
+	test.That(t, misses, test.ShouldEqual, 1)
+
+	// the same ground is found again without RANSAC, until the plane has been used for 3 frames
+	for range 3 {
+		in, out := find(scene)
+		test.That(t, in, test.ShouldEqual, inliers)
+		test.That(t, out, test.ShouldEqual, outliers)
+	}
+	hits, misses = cache.stats()
+	test.That(t, hits, test.ShouldEqual, 3)
+	test.That(t, misses, test.ShouldEqual, 1)
+	find(scene)
+	hits, misses = cache.stats()
+	test.That(t, hits, test.ShouldEqual, 3)
+	test.That(t, misses, test.ShouldEqual, 2)
+
+	// the ground moved away from the cached plane, RANSAC finds it again
+	tilted, _ := tiltedScene(t, r3.Vector{X: 0.2, Z: 1})
+	in, _ := find(tilted)
+	test.That(t, in, test.ShouldEqual, 40*40)
+	hits, misses = cache.stats()
+	test.That(t, hits, test.ShouldEqual, 3)
+	test.That(t, misses, test.ShouldEqual, 3)
+}
+
+func TestPlaneCacheStats(t *testing.T) {
+	cam := &inject.Camera{}
+	cloud, _ := tiltedScene(t, r3.Vector{Z: 1})
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return cloud, nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 10,
+		DefaultCamera:    "fakeCamera",
+	}
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_cache"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	cmd := map[string]interface{}{"command": "get_stats"}
+	resp, err := service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp, test.ShouldResemble, map[string]interface{}{"segmentations": 0})
+
+	params.GroundPlaneCache = true
+	service, err = registerPointCloudSegmenter(context.Background(), svision.Named("test_cache"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	for range 3 {
+		objects, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, objects, test.ShouldHaveLength, 2)
+	}
+	resp, err = service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["segmentations"], test.ShouldEqual, 3)
+	test.That(t, resp["ground_plane_cache_hits"], test.ShouldEqual, 2)
+	test.That(t, resp["ground_plane_cache_misses"], test.ShouldEqual, 1)
+}
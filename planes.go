@@ -0,0 +1,117 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// PlaneOrientation filters the planes removed after the ground plane by the angle of their normal to the
+// ground normal.
+type PlaneOrientation string
+
+// The plane orientations. A horizontal plane, like a table, has its normal within the plane angle tolerance
+// of the ground normal, and a vertical plane, like a wall, has it within the tolerance of the ground.
+const (
+	PlaneHorizontal PlaneOrientation = "horizontal"
+	PlaneVertical   PlaneOrientation = "vertical"
+	PlaneAny        PlaneOrientation = "any"
+)
+
+// The kinds of removed planes. An inclined plane, like a ramp, is neither horizontal nor vertical.
+const (
+	planeKindGround   = "ground"
+	planeKindInclined = "inclined"
+)
+
+// Default values of the plane removal.
+const (
+	MaxPlanesToRemoveDefault   = 1
+	PlaneAngleToleranceDefault = 10.
+)
+
+// accepts returns whether a unit normal is within tolerance degrees of the orientation relative to the ground.
+func (o PlaneOrientation) accepts(normal, ground r3.Vector, tolerance float64) bool {
+	cos := math.Abs(normal.Dot(ground))
+	switch o {
+	case PlaneHorizontal:
+		return cos >= math.Cos(tolerance*math.Pi/180)
+	case PlaneVertical:
+		return cos <= math.Sin(tolerance*math.Pi/180)
+	default:
+		return true
+	}
+}
+
+// planeOrientations converts the plane_orientations of a service config.
+func planeOrientations(orientations []string) []PlaneOrientation {
+	res := make([]PlaneOrientation, 0, len(orientations))
+	for _, o := range orientations {
+		res = append(res, PlaneOrientation(o))
+	}
+	return res
+}
+
+// planeOrientation returns the orientation filter of the i-th plane removed after the ground plane. The last
+// filter of cfg.PlaneOrientations is used for the planes past the end of the list.
+func planeOrientation(cfg *ErCCLConfig, i int) PlaneOrientation {
+	if len(cfg.PlaneOrientations) == 0 {
+		return PlaneAny
+	}
+	return cfg.PlaneOrientations[min(i, len(cfg.PlaneOrientations)-1)]
+}
+
+// removePlanes peels off up to cfg.MaxPlanesToRemove-1 planes from cloud, the largest first, each with the
+// orientation filter of its rank. It stops at the first plane that does not have more than cfg.MinPtsInPlane
+// points, and returns the planes it removed with the points that are left.
+func removePlanes(
+	ctx context.Context, cloud pc.PointCloud, ground r3.Vector, cfg *ErCCLConfig, deadline time.Time,
+) ([]pc.Plane, pc.PointCloud, bool, error) {
+	var planes []pc.Plane
+	capped := false
+	for i := 0; i < cfg.MaxPlanesToRemove-1; i++ {
+		orientation := planeOrientation(cfg, i)
+		plane, rest, planeCapped, err := findPlane(ctx, cloud, cfg, func(normal r3.Vector) bool {
+			return orientation.accepts(normal, ground, cfg.PlaneAngleTolerance)
+		}, deadline)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		capped = capped || planeCapped
+		if plane == nil {
+			break
+		}
+		planes = append(planes, plane)
+		cloud = rest
+	}
+	return planes, cloud, capped, nil
+}
+
+// planeKind returns whether a removed plane is horizontal, vertical or inclined relative to the ground.
+func planeKind(plane pc.Plane, ground r3.Vector, tolerance float64) string {
+	normal := plane.Normal().Normalize()
+	switch {
+	case PlaneHorizontal.accepts(normal, ground, tolerance):
+		return string(PlaneHorizontal)
+	case PlaneVertical.accepts(normal, ground, tolerance):
+		return string(PlaneVertical)
+	default:
+		return planeKindInclined
+	}
+}
+
+// planeEquation returns the unit normal and the offset of the equation normal.p + offset = 0 of a plane,
+// with the normal on the side of toward.
+func planeEquation(plane pc.Plane, toward r3.Vector) (r3.Vector, float64) {
+	eq := plane.Equation()
+	normal := r3.Vector{X: eq[0], Y: eq[1], Z: eq[2]}
+	scale := 1 / normal.Norm()
+	if normal.Dot(toward) < 0 {
+		scale = -scale
+	}
+	return normal.Mul(scale), eq[3] * scale
+}
@@ -0,0 +1,94 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+)
+
+// roomScene builds a cloud of a floor with a wall along one side and a box on the floor.
+func roomScene(t *testing.T) pc.PointCloud {
+	t.Helper()
+	return scene{
+		groundMax:  r3.Vector{X: 400, Y: 400},
+		groundStep: 10,
+		boxes: []sceneBox{
+			// the wall, one point thick
+			{min: r3.Vector{X: -50, Y: 0, Z: 20}, max: r3.Vector{X: -50, Y: 390, Z: 410}, step: r3.Vector{X: 10, Y: 10, Z: 10}},
+			smallBox(r3.Vector{X: 200, Y: 200}),
+		},
+	}.cloud(t)
+}
+
+func TestRemovePlanes(t *testing.T) {
+	cam := &inject.Camera{}
+	cloud := roomScene(t)
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return cloud, nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 10,
+		DefaultCamera:    "fakeCamera",
+	}
+	segment := func() ([]interface{}, int) {
+		service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_planes"), params, deps, nil)
+		test.That(t, err, test.ShouldBeNil)
+		objects, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+		test.That(t, err, test.ShouldBeNil)
+		resp, err := service.DoCommand(context.Background(), map[string]interface{}{"command": "get_planes"})
+		test.That(t, err, test.ShouldBeNil)
+		return resp["planes"].([]interface{}), len(objects)
+	}
+
+	// only the floor is removed, the wall is an obstacle
+	planes, objects := segment()
+	test.That(t, planes, test.ShouldHaveLength, 1)
+	test.That(t, planes[0].(map[string]interface{})["kind"], test.ShouldEqual, "ground")
+	test.That(t, objects, test.ShouldEqual, 2)
+
+	// the wall is removed too
+	params.MaxPlanesToRemove = 3
+	planes, objects = segment()
+	test.That(t, planes, test.ShouldHaveLength, 2)
+	wall := planes[1].(map[string]interface{})
+	test.That(t, wall["kind"], test.ShouldEqual, "vertical")
+	test.That(t, wall["inlier_count"], test.ShouldEqual, 40*40)
+	test.That(t, wall["angle_to_ground_degs"], test.ShouldAlmostEqual, 90, 1e-6)
+	normal := wall["normal"].(map[string]interface{})
+	test.That(t, normal["x"], test.ShouldAlmostEqual, 1, 1e-6)
+	test.That(t, wall["offset_mm"], test.ShouldAlmostEqual, 50, 1e-6)
+	test.That(t, objects, test.ShouldEqual, 1)
+
+	// there is no horizontal plane besides the floor, so the wall stays
+	params.PlaneOrientations = []string{"horizontal"}
+	planes, objects = segment()
+	test.That(t, planes, test.ShouldHaveLength, 1)
+	test.That(t, objects, test.ShouldEqual, 2)
+}
+
+func TestPlaneOrientation(t *testing.T) {
+	ground := r3.Vector{Z: 1}
+	tilted := r3.Vector{X: 0.1, Z: 1}.Normalize()
+	test.That(t, PlaneHorizontal.accepts(tilted, ground, 10), test.ShouldBeTrue)
+	test.That(t, PlaneHorizontal.accepts(tilted.Mul(-1), ground, 10), test.ShouldBeTrue)
+	test.That(t, PlaneVertical.accepts(tilted, ground, 10), test.ShouldBeFalse)
+	test.That(t, PlaneVertical.accepts(r3.Vector{X: 1, Z: 0.1}.Normalize(), ground, 10), test.ShouldBeTrue)
+	test.That(t, PlaneAny.accepts(r3.Vector{X: 1, Z: 1}.Normalize(), ground, 10), test.ShouldBeTrue)
+
+	cfg := &ErCCLConfig{PlaneOrientations: []PlaneOrientation{PlaneVertical, PlaneHorizontal}}
+	test.That(t, planeOrientation(cfg, 0), test.ShouldEqual, PlaneVertical)
+	test.That(t, planeOrientation(cfg, 5), test.ShouldEqual, PlaneHorizontal)
+	test.That(t, planeOrientation(&ErCCLConfig{}, 0), test.ShouldEqual, PlaneAny)
+}
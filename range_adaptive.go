@@ -0,0 +1,101 @@
+package obstaclespointcloud
+
+import (
+	"math"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// RangeCurvePoint is a point of a RangeCurve: the clustering radius, in grid cells, and the minimum number of
+// points of an object at the given distance to the sensor.
+type RangeCurvePoint struct {
+	Range            float64 `json:"range_mm"`
+	ClusteringRadius float64 `json:"clustering_radius"`
+	MinPtsInSegment  float64 `json:"min_points_in_segment"`
+}
+
+// RangeCurve makes the clustering follow the sparsity of the points of a lidar, which get further apart with
+// distance: the clustering radius and the minimum number of points of an object are interpolated linearly
+// between its points, by the distance to the sensor along the ground, and are those of the first or last point
+// before or after them.
+type RangeCurve []RangeCurvePoint
+
+// Validate returns an error if the curve is not a list of points of increasing range.
+func (c RangeCurve) Validate() error {
+	for i, p := range c {
+		if p.Range < 0 {
+			return errors.New("range_adaptive_clustering range_mm must be non-negative")
+		}
+		if i > 0 && p.Range <= c[i-1].Range {
+			return errors.New("range_adaptive_clustering range_mm must be increasing")
+		}
+		if p.ClusteringRadius < 1 {
+			return errors.New("range_adaptive_clustering clustering_radius must be at least 1")
+		}
+		if p.MinPtsInSegment < 1 {
+			return errors.New("range_adaptive_clustering min_points_in_segment must be at least 1")
+		}
+	}
+	return nil
+}
+
+// at returns the clustering radius and the minimum number of points of an object at the given range.
+func (c RangeCurve) at(r float64) (int, int) {
+	if r <= c[0].Range {
+		return int(math.Round(c[0].ClusteringRadius)), int(math.Round(c[0].MinPtsInSegment))
+	}
+	for k := 1; k < len(c); k++ {
+		if r <= c[k].Range {
+			t := (r - c[k-1].Range) / (c[k].Range - c[k-1].Range)
+			radius := c[k-1].ClusteringRadius + t*(c[k].ClusteringRadius-c[k-1].ClusteringRadius)
+			minPts := c[k-1].MinPtsInSegment + t*(c[k].MinPtsInSegment-c[k-1].MinPtsInSegment)
+			return int(math.Round(radius)), int(math.Round(minPts))
+		}
+	}
+	last := c[len(c)-1]
+	return int(math.Round(last.ClusteringRadius)), int(math.Round(last.MinPtsInSegment))
+}
+
+// maxRadius returns the largest clustering radius of the curve.
+func (c RangeCurve) maxRadius() int {
+	r := 1
+	for _, p := range c {
+		r = max(r, int(math.Round(p.ClusteringRadius)))
+	}
+	return r
+}
+
+// minRadius returns the smallest clustering radius of the curve.
+func (c RangeCurve) minRadius() int {
+	r := math.MaxInt
+	for _, p := range c {
+		r = min(r, int(math.Round(p.ClusteringRadius)))
+	}
+	return r
+}
+
+// cellRadii returns the clustering radius of every cell of the label map of a ground aligned cloud, by the
+// distance of the center of the cell to the sensor, which is at the origin.
+func (c RangeCurve) cellRadii(labelMap [][]node, meta pc.MetaData, s float64) [][]int {
+	radii := make([][]int, len(labelMap))
+	for i, row := range labelMap {
+		radii[i] = make([]int, len(row))
+		// the inverse of gridCell, cell i holds the points in (MinX + (i-1)s, MinX + is]
+		x := meta.MinX + (float64(i)-0.5)*s
+		for j := range row {
+			y := meta.MinY + (float64(j)-0.5)*s
+			radii[i][j], _ = c.at(math.Hypot(x, y))
+		}
+	}
+	return radii
+}
+
+// minPoints returns the minimum number of points of an object with the given centroid in the sensor frame.
+func (c RangeCurve) minPoints(centroid r3.Vector, ground groundFrame) int {
+	p := ground.fromSensor(centroid)
+	_, minPts := c.at(math.Hypot(p.X, p.Y))
+	return minPts
+}
@@ -0,0 +1,71 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+)
+
+func TestRangeCurve(t *testing.T) {
+	curve := RangeCurve{{Range: 1000, ClusteringRadius: 2, MinPtsInSegment: 40}, {Range: 3000, ClusteringRadius: 6, MinPtsInSegment: 10}}
+	test.That(t, curve.Validate(), test.ShouldBeNil)
+	for _, c := range []struct {
+		r              float64
+		radius, minPts int
+	}{{0, 2, 40}, {1000, 2, 40}, {2000, 4, 25}, {3000, 6, 10}, {10000, 6, 10}} {
+		radius, minPts := curve.at(c.r)
+		test.That(t, radius, test.ShouldEqual, c.radius)
+		test.That(t, minPts, test.ShouldEqual, c.minPts)
+	}
+	test.That(t, curve.maxRadius(), test.ShouldEqual, 6)
+
+	test.That(t, RangeCurve{curve[1], curve[0]}.Validate().Error(), test.ShouldContainSubstring, "increasing")
+	test.That(t, RangeCurve{{Range: 0, ClusteringRadius: 0, MinPtsInSegment: 10}}.Validate().Error(),
+		test.ShouldContainSubstring, "clustering_radius")
+}
+
+func TestRangeAdaptiveClustering(t *testing.T) {
+	// post returns a post of points step mm apart over an area of the ground, from 20 to 220 mm above it
+	post := func(x, y [2]float64, step float64) sceneBox {
+		return sceneBox{
+			min:  r3.Vector{X: x[0], Y: y[0], Z: 20},
+			max:  r3.Vector{X: x[1], Y: y[1], Z: 220},
+			step: r3.Vector{X: step, Y: step, Z: 20},
+		}
+	}
+	cloud := scene{
+		groundMin:  r3.Vector{X: 0, Y: -2000},
+		groundMax:  r3.Vector{X: 9000, Y: 2000},
+		groundStep: 100,
+		height:     func(_, _ float64) float64 { return -1000 },
+		boxes: []sceneBox{
+			// two dense posts near the sensor, 4 grid cells apart
+			post([2]float64{1000, 1040}, [2]float64{0, 40}, 20),
+			post([2]float64{1000, 1040}, [2]float64{120, 160}, 20),
+			// a sparse object far from the sensor, with its points 4 grid cells apart, and a small post
+			post([2]float64{8000, 8240}, [2]float64{0, 240}, 80),
+			post([2]float64{8000, 8000}, [2]float64{1000, 1000}, 20),
+		},
+	}.cloud(t)
+
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MinPtsInSegment: 20, MaxDistFromPlane: 5, GridResolution: 20}
+	cfg.SetDefaultValues()
+	count := func(radius int, curve RangeCurve) int {
+		cfg.ClusteringRadius = radius
+		cfg.RangeAdaptiveClustering = curve
+		objects, err := ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+		test.That(t, err, test.ShouldBeNil)
+		return len(objects)
+	}
+	// a small radius splits the near posts and shatters the far object into fragments that are too small
+	test.That(t, count(3, nil), test.ShouldEqual, 2)
+	// a large radius keeps the far object whole, but merges the near posts
+	test.That(t, count(5, nil), test.ShouldEqual, 2)
+	// both come out right when the radius grows with range, and the small post is kept far away
+	test.That(t, count(3, RangeCurve{
+		{Range: 2000, ClusteringRadius: 3, MinPtsInSegment: 20},
+		{Range: 6000, ClusteringRadius: 5, MinPtsInSegment: 10},
+	}), test.ShouldEqual, 4)
+}
@@ -0,0 +1,192 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang/geo/r3"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// ClusteringMode is how the points above the ground are grouped into obstacles.
+type ClusteringMode string
+
+// The clustering modes. The grid projects the points on a 2D grid on the ground and links the nearby cells of
+// similar heights. The range image puts the points of a spinning lidar in an image of rings by azimuth bins, and
+// links the neighboring pixels whose beams hit the same surface, judged by the angle between the line joining
+// their points and the beam, as in Bogoslavskyi and Stachniss, "Fast range image-based segmentation of sparse
+// 3D laser scans for online operation".
+const (
+	ClusteringGrid       ClusteringMode = "grid"
+	ClusteringRangeImage ClusteringMode = "range_image"
+)
+
+// Default values of the range image clustering, for a 16 ring lidar.
+const (
+	RangeImageVerticalResolutionDefault   = 2.
+	RangeImageHorizontalResolutionDefault = 0.4
+	RangeImageAngleThresholdDefault       = 10.
+)
+
+// rangePixel is a pixel of the range image, with the points of the sensor frame that fall in it.
+type rangePixel struct {
+	// depth is the smallest range of the points of the pixel, 0 if it is empty
+	depth  float64
+	points []r3.Vector
+	data   []pc.Data
+	label  int
+}
+
+// rangeImage is the range image of a point cloud, rows are elevations and columns azimuths around the ground
+// normal, both seen from the sensor.
+type rangeImage struct {
+	pixels     [][]rangePixel
+	vRes, hRes float64
+	rows, cols int
+}
+
+// newRangeImage returns the range image of the cloud with the given vertical and horizontal resolution in
+// radians. The angles are measured in the ground frame, centered on the sensor.
+func newRangeImage(ctx context.Context, cloud pc.PointCloud, ground groundFrame, vRes, hRes float64) (*rangeImage, error) {
+	type polar struct {
+		p                     r3.Vector
+		d                     pc.Data
+		r, elevation, azimuth float64
+	}
+	points := make([]polar, 0, cloud.Size())
+	minElevation, maxElevation := math.Inf(1), math.Inf(-1)
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		g := ground.fromSensor(p)
+		r := g.Norm()
+		if r == 0 {
+			return true
+		}
+		e := math.Asin(g.Z / r)
+		minElevation = math.Min(minElevation, e)
+		maxElevation = math.Max(maxElevation, e)
+		points = append(points, polar{p: p, d: d, r: r, elevation: e, azimuth: math.Atan2(g.Y, g.X)})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	img := &rangeImage{vRes: vRes, hRes: hRes, cols: int(math.Ceil(2 * math.Pi / hRes))}
+	if len(points) == 0 {
+		return img, nil
+	}
+	img.rows = int(math.Round((maxElevation-minElevation)/vRes)) + 1
+	img.pixels = make([][]rangePixel, img.rows)
+	for i := range img.pixels {
+		img.pixels[i] = make([]rangePixel, img.cols)
+	}
+	for _, p := range points {
+		// the rings are centered on the rows, starting from the lowest one
+		row := int(math.Round((p.elevation - minElevation) / vRes))
+		col := int(math.Round((p.azimuth+math.Pi)/hRes)) % img.cols
+		pixel := &img.pixels[row][col]
+		if pixel.depth == 0 || p.r < pixel.depth {
+			pixel.depth = p.r
+		}
+		pixel.points = append(pixel.points, p.p)
+		pixel.data = append(pixel.data, p.d)
+	}
+	return img, nil
+}
+
+// sameObject returns whether the neighboring pixels with the given depths, whose beams are alpha radians apart,
+// see the same object. The angle beta between the far beam and the line joining the two points is small when
+// they are on a surface seen at a grazing angle, or on two objects one behind the other.
+func sameObject(d1, d2, alpha, threshold float64) bool {
+	far, near := math.Max(d1, d2), math.Min(d1, d2)
+	beta := math.Atan2(near*math.Sin(alpha), far-near*math.Cos(alpha))
+	return beta > threshold
+}
+
+// label labels the connected components of the nonempty pixels of the image with a breadth first search, the
+// columns wrap around. The search steps over one empty pixel to the next one, so a return that is missing, or
+// a pixel left empty by the binning of the azimuths, does not split an object. It stops once ctx is done.
+func (img *rangeImage) label(ctx context.Context, threshold float64) error {
+	for i := range img.pixels {
+		for j := range img.pixels[i] {
+			img.pixels[i][j].label = -1
+		}
+	}
+	type index struct{ row, col int }
+	directions := []struct {
+		drow, dcol int
+		alpha      float64
+	}{{-1, 0, img.vRes}, {1, 0, img.vRes}, {0, -1, img.hRes}, {0, 1, img.hRes}}
+	labels := 0
+	var queue []index
+	for i := range img.pixels {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for j := range img.pixels[i] {
+			if img.pixels[i][j].depth == 0 || img.pixels[i][j].label != -1 {
+				continue
+			}
+			img.pixels[i][j].label = labels
+			queue = append(queue[:0], index{i, j})
+			for len(queue) > 0 {
+				cur := queue[0]
+				queue = queue[1:]
+				depth := img.pixels[cur.row][cur.col].depth
+				for _, dir := range directions {
+					for step := 1; step <= 2; step++ {
+						row, col := cur.row+step*dir.drow, (cur.col+step*dir.dcol+img.cols)%img.cols
+						if row < 0 || row >= img.rows {
+							break
+						}
+						neighbor := &img.pixels[row][col]
+						if neighbor.depth == 0 {
+							continue
+						}
+						if neighbor.label == -1 && sameObject(depth, neighbor.depth, float64(step)*dir.alpha, threshold) {
+							neighbor.label = labels
+							queue = append(queue, index{row, col})
+						}
+						break
+					}
+				}
+			}
+			labels++
+		}
+	}
+	return nil
+}
+
+// rangeImageSegments clusters the points of the cloud in its range image, and returns the points of each label.
+func rangeImageSegments(
+	ctx context.Context, cloud pc.PointCloud, ground groundFrame, cfg *ErCCLConfig,
+) (map[int]pc.PointCloud, error) {
+	toRadians := math.Pi / 180
+	img, err := newRangeImage(ctx, cloud, ground, cfg.RangeImageVerticalResolution*toRadians,
+		cfg.RangeImageHorizontalResolution*toRadians)
+	if err != nil {
+		return nil, err
+	}
+	if err := img.label(ctx, cfg.RangeImageAngleThreshold*toRadians); err != nil {
+		return nil, err
+	}
+	segments := make(map[int]pc.PointCloud)
+	for _, row := range img.pixels {
+		for _, pixel := range row {
+			if pixel.depth == 0 {
+				continue
+			}
+			segment, ok := segments[pixel.label]
+			if !ok {
+				segment = pc.NewBasicEmpty()
+				segments[pixel.label] = segment
+			}
+			for k, p := range pixel.points {
+				if err := segment.Set(p, pixel.data[k]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,99 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// box is an axis-aligned box, for ray casting.
+type box struct {
+	min, max r3.Vector
+}
+
+// hit returns the distance along the unit direction dir from the origin to the box, if the ray hits it.
+func (b box) hit(dir r3.Vector) (float64, bool) {
+	near, far := 0., math.Inf(1)
+	for _, axis := range []struct{ d, lo, hi float64 }{{dir.X, b.min.X, b.max.X}, {dir.Y, b.min.Y, b.max.Y}, {dir.Z, b.min.Z, b.max.Z}} {
+		if axis.d == 0 {
+			if axis.lo > 0 || axis.hi < 0 {
+				return 0, false
+			}
+			continue
+		}
+		t1, t2 := axis.lo/axis.d, axis.hi/axis.d
+		near, far = math.Max(near, math.Min(t1, t2)), math.Min(far, math.Max(t1, t2))
+	}
+	return near, near <= far
+}
+
+// lidarScan returns the scan of a 16 ring lidar 1 m above the ground, with rings 2 degrees apart and 0.4 degrees
+// between its points, up to 20 m away.
+func lidarScan(t *testing.T, boxes []box) pc.PointCloud {
+	t.Helper()
+	cloud := pc.NewBasicEmpty()
+	for ring := 0; ring < 16; ring++ {
+		elevation := float64(2*ring-15) * math.Pi / 180
+		for step := 0; step < 900; step++ {
+			azimuth := float64(step)*0.4*math.Pi/180 - math.Pi
+			dir := r3.Vector{
+				X: math.Cos(elevation) * math.Cos(azimuth),
+				Y: math.Cos(elevation) * math.Sin(azimuth),
+				Z: math.Sin(elevation),
+			}
+			distance := math.Inf(1)
+			if dir.Z < 0 {
+				distance = -1000 / dir.Z
+			}
+			for _, b := range boxes {
+				if d, ok := b.hit(dir); ok {
+					distance = math.Min(distance, d)
+				}
+			}
+			if distance < 20000 {
+				test.That(t, cloud.Set(dir.Mul(distance), pc.NewBasicData()), test.ShouldBeNil)
+			}
+		}
+	}
+	return cloud
+}
+
+func TestSameObject(t *testing.T) {
+	alpha := 0.4 * math.Pi / 180
+	threshold := 10 * math.Pi / 180
+	// a wall facing the sensor
+	test.That(t, sameObject(3000, 3000, alpha, threshold), test.ShouldBeTrue)
+	// an object 2 m behind another
+	test.That(t, sameObject(3000, 5000, alpha, threshold), test.ShouldBeFalse)
+}
+
+func TestRangeImageClustering(t *testing.T) {
+	boxes := []box{
+		{min: r3.Vector{X: 3000, Y: -200, Z: -1000}, max: r3.Vector{X: 3400, Y: 200}},
+		// behind the first box, and partly hidden by it
+		{min: r3.Vector{X: 5000, Y: 100, Z: -1000}, max: r3.Vector{X: 5400, Y: 500}},
+		{min: r3.Vector{X: -400, Y: -3000, Z: -1000}, max: r3.Vector{X: 400, Y: -2600}},
+	}
+	cloud := lidarScan(t, boxes)
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MinPtsInSegment: 10, MaxDistFromPlane: 20, ClusteringMode: ClusteringRangeImage}
+	cfg.SetDefaultValues()
+	objects, err := ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, len(boxes))
+	for _, b := range boxes {
+		found := false
+		for _, o := range objects {
+			// the points are on the faces seen by the lidar, so the centroid is in the footprint of the box
+			c := pc.CloudCentroid(o.PointCloud)
+			if c.X >= b.min.X && c.X <= b.max.X && c.Y >= b.min.Y && c.Y <= b.max.Y {
+				found = true
+			}
+		}
+		test.That(t, found, test.ShouldBeTrue)
+	}
+}
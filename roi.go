@@ -0,0 +1,169 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang/geo/r3"
+	"github.com/pkg/errors"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/robot/framesystem"
+	"go.viam.com/rdk/spatialmath"
+)
+
+// RegionOfInterest is the part of the point clouds that is segmented, the points outside of it are dropped
+// before the ground is looked for. All the limits that are set have to hold for a point to be kept. They are
+// in the frame of the sensor, or in the named frame of the frame system if Frame is set. The ranges are measured
+// from the origin of the frame, and the azimuths on the ground, about the up direction of the frame: the ground
+// normal in the frame of the sensor, and +Z in a named frame.
+type RegionOfInterest struct {
+	Frame string `json:"frame,omitempty"`
+	// X, Y and Z are the [min, max] of an axis-aligned box, in mm
+	X []float64 `json:"x_mm,omitempty"`
+	Y []float64 `json:"y_mm,omitempty"`
+	Z []float64 `json:"z_mm,omitempty"`
+	// MinRange and MaxRange are the distance to the origin of the frame, the sensor if Frame is not set, in mm.
+	// A MaxRange of 0 is no limit.
+	MinRange float64 `json:"min_range_mm,omitempty"`
+	MaxRange float64 `json:"max_range_mm,omitempty"`
+	// AzimuthMin and AzimuthMax are the sector around the up direction that is kept, in degrees from +X toward
+	// up x +X, which is +Y when Z is up and the optical axis +Z when -Y is up. X is projected on the ground
+	// first. The sector goes through 180 degrees if AzimuthMin is more than AzimuthMax.
+	AzimuthMin *float64 `json:"azimuth_min_degs,omitempty"`
+	AzimuthMax *float64 `json:"azimuth_max_degs,omitempty"`
+}
+
+// Validate returns the dependencies of the region of interest, the frame system if it is in a named frame.
+func (roi *RegionOfInterest) Validate() ([]string, error) {
+	for _, axis := range []struct {
+		name   string
+		limits []float64
+	}{{"x_mm", roi.X}, {"y_mm", roi.Y}, {"z_mm", roi.Z}} {
+		if axis.limits == nil {
+			continue
+		}
+		if len(axis.limits) != 2 {
+			return nil, errors.Errorf("region_of_interest %s must be [min, max]", axis.name)
+		}
+		if axis.limits[0] > axis.limits[1] {
+			return nil, errors.Errorf("region_of_interest %s min must not be more than its max", axis.name)
+		}
+	}
+	if roi.MinRange < 0 {
+		return nil, errors.New("region_of_interest min_range_mm must be non-negative")
+	}
+	if roi.MaxRange < 0 {
+		return nil, errors.New("region_of_interest max_range_mm must be non-negative")
+	}
+	if roi.MaxRange != 0 && roi.MinRange > roi.MaxRange {
+		return nil, errors.New("region_of_interest min_range_mm must not be more than max_range_mm")
+	}
+	if (roi.AzimuthMin == nil) != (roi.AzimuthMax == nil) {
+		return nil, errors.New("region_of_interest needs both azimuth_min_degs and azimuth_max_degs")
+	}
+	if roi.AzimuthMin != nil && (math.Abs(*roi.AzimuthMin) > 180 || math.Abs(*roi.AzimuthMax) > 180) {
+		return nil, errors.New("region_of_interest azimuths must be between -180 and 180")
+	}
+	if roi.Frame == "" {
+		return nil, nil
+	}
+	return []string{framesystem.PublicServiceName.String()}, nil
+}
+
+// contains returns whether a point of the frame of the region is in it. The azimuths are measured in ground, the
+// ground frame of the up direction of the region.
+func (roi *RegionOfInterest) contains(p r3.Vector, ground groundFrame) bool {
+	for _, axis := range []struct {
+		v      float64
+		limits []float64
+	}{{p.X, roi.X}, {p.Y, roi.Y}, {p.Z, roi.Z}} {
+		if len(axis.limits) == 2 && (axis.v < axis.limits[0] || axis.v > axis.limits[1]) {
+			return false
+		}
+	}
+	if roi.MinRange > 0 || roi.MaxRange > 0 {
+		r := p.Norm()
+		if r < roi.MinRange || (roi.MaxRange > 0 && r > roi.MaxRange) {
+			return false
+		}
+	}
+	if roi.AzimuthMin != nil {
+		g := ground.fromSensor(p)
+		azimuth := math.Atan2(g.Y, g.X) * 180 / math.Pi
+		lo, hi := *roi.AzimuthMin, *roi.AzimuthMax
+		if lo <= hi {
+			return azimuth >= lo && azimuth <= hi
+		}
+		return azimuth >= lo || azimuth <= hi
+	}
+	return true
+}
+
+// regionOfInterest crops the point clouds of the cameras to a RegionOfInterest.
+type regionOfInterest struct {
+	cfg RegionOfInterest
+	// pose returns the pose of a camera in the frame of the region, it is nil if the region is in the frame
+	// of the sensor
+	pose func(ctx context.Context, camera string) (spatialmath.Pose, error)
+	// up is the up direction of the region, the ground normal of the point clouds if the region is in the
+	// frame of the sensor, and output is the frame up is in if it is not the frame of the sensor
+	up     r3.Vector
+	output *outputFrame
+}
+
+// newRegionOfInterest returns the cropper of a region of interest, which looks up the poses of the cameras in
+// the frame system of deps if the region is in a named frame. normal is the ground normal of the point clouds,
+// in output if it is not nil.
+func newRegionOfInterest(
+	cfg *RegionOfInterest, normal r3.Vector, output *outputFrame, deps resource.Dependencies,
+) (*regionOfInterest, error) {
+	roi := &regionOfInterest{cfg: *cfg, up: normal, output: output}
+	if cfg.Frame == "" {
+		return roi, nil
+	}
+	roi.up, roi.output = r3.Vector{Z: 1}, nil
+	pose, err := framePose(deps, cfg.Frame)
+	if err != nil {
+		return nil, errors.Wrap(err, "region_of_interest frame needs the frame system")
+	}
+	roi.pose = pose
+	return roi, nil
+}
+
+// crop returns the points of the cloud of camera that are in the region, in the frame of the sensor.
+func (roi *regionOfInterest) crop(ctx context.Context, cloud pc.PointCloud, camera string) (pc.PointCloud, error) {
+	toRegion := func(p r3.Vector) r3.Vector { return p }
+	if roi.pose != nil {
+		pose, err := roi.pose(ctx, camera)
+		if err != nil {
+			return nil, err
+		}
+		toRegion = poseTransform(pose)
+	}
+	up := roi.up
+	if roi.output != nil {
+		var err error
+		up, err = roi.output.directionInCamera(ctx, camera, up)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ground := newGroundFrame(up)
+	cropped := pc.NewBasicEmpty()
+	var setErr error
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		if roi.cfg.contains(toRegion(p), ground) {
+			setErr = cropped.Set(p, d)
+		}
+		return setErr == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if setErr != nil {
+		return nil, setErr
+	}
+	return cropped, nil
+}
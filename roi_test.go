@@ -0,0 +1,114 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/referenceframe"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/robot/framesystem"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/testutils/inject"
+)
+
+func TestRegionOfInterestContains(t *testing.T) {
+	zUp := newGroundFrame(r3.Vector{Z: 1})
+	roi := &RegionOfInterest{X: []float64{-100, 100}, Z: []float64{0, 50}}
+	test.That(t, roi.contains(r3.Vector{X: 50, Y: 1000, Z: 10}, zUp), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{X: 150, Y: 0, Z: 10}, zUp), test.ShouldBeFalse)
+	test.That(t, roi.contains(r3.Vector{X: 50, Y: 0, Z: -10}, zUp), test.ShouldBeFalse)
+
+	roi = &RegionOfInterest{MinRange: 100, MaxRange: 200}
+	test.That(t, roi.contains(r3.Vector{X: 50}, zUp), test.ShouldBeFalse)
+	test.That(t, roi.contains(r3.Vector{X: 100, Y: 100}, zUp), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{Z: 250}, zUp), test.ShouldBeFalse)
+	// the range is the distance to the sensor, the height counts
+	test.That(t, roi.contains(r3.Vector{X: 150, Z: 100}, zUp), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{X: 150, Z: 500}, zUp), test.ShouldBeFalse)
+
+	// a sector of 90 degrees behind the sensor, through 180 degrees
+	lo, hi := 135., -135.
+	roi = &RegionOfInterest{AzimuthMin: &lo, AzimuthMax: &hi}
+	test.That(t, roi.contains(r3.Vector{X: -100, Y: 10}, zUp), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{X: -100, Y: -10}, zUp), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{X: 100}, zUp), test.ShouldBeFalse)
+	test.That(t, roi.contains(r3.Vector{Y: 100}, zUp), test.ShouldBeFalse)
+	lo, hi = -45, 45
+	test.That(t, roi.contains(r3.Vector{X: 100, Y: 10}, zUp), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{X: -100}, zUp), test.ShouldBeFalse)
+
+	// in the frame of a depth camera -Y is up, and the azimuths go from +X toward the optical axis +Z
+	yDown := newGroundFrame(r3.Vector{Y: -1})
+	lo, hi = 45, 135
+	test.That(t, roi.contains(r3.Vector{Y: 300, Z: 1000}, yDown), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{Y: -300, Z: 1000}, yDown), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{X: 1000, Y: 300}, yDown), test.ShouldBeFalse)
+	test.That(t, roi.contains(r3.Vector{Z: -1000}, yDown), test.ShouldBeFalse)
+	roi = &RegionOfInterest{MaxRange: 1000}
+	test.That(t, roi.contains(r3.Vector{Y: 600, Z: 700}, yDown), test.ShouldBeTrue)
+	test.That(t, roi.contains(r3.Vector{Y: 800, Z: 900}, yDown), test.ShouldBeFalse)
+
+	_, err := (&RegionOfInterest{AzimuthMin: &lo}).Validate()
+	test.That(t, err.Error(), test.ShouldContainSubstring, "azimuth_max_degs")
+	_, err = (&RegionOfInterest{MinRange: 200, MaxRange: 100}).Validate()
+	test.That(t, err.Error(), test.ShouldContainSubstring, "min_range_mm")
+	deps, err := (&RegionOfInterest{MaxRange: 100}).Validate()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldBeEmpty)
+}
+
+func TestRegionOfInterestFrame(t *testing.T) {
+	cam := inject.NewCamera("fakeCamera")
+	// a box on the ground in front of the camera, and one behind it
+	s := scene{groundMin: r3.Vector{X: -1000, Y: -1000}, groundMax: r3.Vector{X: 1000, Y: 1000}, groundStep: 10}
+	for _, x := range []float64{500, -500} {
+		s.boxes = append(s.boxes, sceneBox{
+			min:  r3.Vector{X: x - 50, Y: -50, Z: 10},
+			max:  r3.Vector{X: x + 40, Y: 40, Z: 90},
+			step: r3.Vector{X: 10, Y: 10, Z: 10},
+		})
+	}
+	cloud := s.cloud(t)
+	cam.NextPointCloudFunc = func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return cloud, nil
+	}
+	// the camera is 2 m along Y of the world, turned to look along -X of the world
+	fs := inject.NewFrameSystemService("fs")
+	fs.GetPoseFunc = func(
+		ctx context.Context, componentName, destinationFrame string, _ []*referenceframe.LinkInFrame, _ map[string]interface{},
+	) (*referenceframe.PoseInFrame, error) {
+		test.That(t, componentName, test.ShouldEqual, "fakeCamera")
+		test.That(t, destinationFrame, test.ShouldEqual, "world")
+		pose := spatialmath.NewPose(r3.Vector{Y: 2000}, &spatialmath.OrientationVectorDegrees{Theta: 180, OZ: 1})
+		return referenceframe.NewPoseInFrame(destinationFrame, pose), nil
+	}
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam, framesystem.PublicServiceName: fs}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 10,
+		GridResolution:   20,
+		AngleTolerance:   20,
+		DefaultCamera:    "fakeCamera",
+		// in front of the camera is -X of the world
+		RegionOfInterest: &RegionOfInterest{Frame: "world", X: []float64{-1000, 0}},
+	}
+	service, err := registerPointCloudSegmenter(context.Background(), svision.Named("test_roi"), params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	objects, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+	// the points stay in the frame of the camera
+	test.That(t, pc.CloudCentroid(objects[0].PointCloud).X, test.ShouldAlmostEqual, 495, 1)
+
+	_, err = registerPointCloudSegmenter(context.Background(), svision.Named("test_roi"), params,
+		resource.Dependencies{camera.Named("fakeCamera"): cam}, nil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "frame system")
+}
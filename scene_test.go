@@ -0,0 +1,90 @@
+package obstaclespointcloud
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// sceneBox is a box of points standing on the ground of a scene, a point every step mm from min to max included.
+// The heights of its points are above the ground under them.
+type sceneBox struct {
+	min, max, step r3.Vector
+}
+
+// scene describes a cloud of the ground with boxes on it, built in the frame of the ground, with Z up.
+type scene struct {
+	// the ground covers [groundMin, groundMax) along X and Y, a point every groundStep mm, at the height returned by
+	// height, 0 if it is nil. There are no ground points where hole returns true.
+	groundMin, groundMax r3.Vector
+	groundStep           float64
+	height               func(x, y float64) float64
+	hole                 func(x, y float64) bool
+	boxes                []sceneBox
+	// noise is the standard deviation, in mm, of the noise added to the heights of the points
+	noise float64
+	// toSensor moves the points to the frame of the sensor, they stay in the frame of the ground if it is nil
+	toSensor func(p r3.Vector) r3.Vector
+}
+
+// groundHeight returns the height of the ground of the scene at (x, y).
+func (s scene) groundHeight(x, y float64) float64 {
+	if s.height == nil {
+		return 0
+	}
+	return s.height(x, y)
+}
+
+// sensorPoint returns a point of the frame of the ground in the frame of the sensor.
+func (s scene) sensorPoint(p r3.Vector) r3.Vector {
+	if s.toSensor == nil {
+		return p
+	}
+	return s.toSensor(p)
+}
+
+// cloud returns the points of the scene in the frame of the sensor. The noise is the same in every call.
+func (s scene) cloud(t *testing.T) pc.PointCloud {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	cloud := pc.NewBasicEmpty()
+	set := func(x, y, z float64) {
+		if s.noise > 0 {
+			z += rng.NormFloat64() * s.noise
+		}
+		test.That(t, cloud.Set(s.sensorPoint(r3.Vector{X: x, Y: y, Z: z}), pc.NewBasicData()), test.ShouldBeNil)
+	}
+	if s.groundStep > 0 {
+		for x := s.groundMin.X; x < s.groundMax.X; x += s.groundStep {
+			for y := s.groundMin.Y; y < s.groundMax.Y; y += s.groundStep {
+				if s.hole == nil || !s.hole(x, y) {
+					set(x, y, s.groundHeight(x, y))
+				}
+			}
+		}
+	}
+	for _, b := range s.boxes {
+		for x := b.min.X; x <= b.max.X; x += b.step.X {
+			for y := b.min.Y; y <= b.max.Y; y += b.step.Y {
+				for z := b.min.Z; z <= b.max.Z; z += b.step.Z {
+					set(x, y, s.groundHeight(x, y)+z)
+				}
+			}
+		}
+	}
+	return cloud
+}
+
+// centers returns the centers of the boxes of the scene in the frame of the sensor.
+func (s scene) centers() []r3.Vector {
+	centers := make([]r3.Vector, 0, len(s.boxes))
+	for _, b := range s.boxes {
+		c := b.min.Add(b.max).Mul(0.5)
+		centers = append(centers, s.sensorPoint(r3.Vector{X: c.X, Y: c.Y, Z: s.groundHeight(c.X, c.Y) + c.Z}))
+	}
+	return centers
+}
@@ -0,0 +1,228 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/golang/geo/r3"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// GroundSegmentation is how the ground is separated from the obstacles.
+type GroundSegmentation string
+
+// The ground segmentations. The plane is one plane found by RANSAC for the whole cloud. The zones cut the
+// ground into concentric zones around the sensor, split into sectors, and fit a local ground to each, so hills
+// and ditches are ground and points are judged by their height above the local ground.
+const (
+	GroundPlane GroundSegmentation = "plane"
+	GroundZones GroundSegmentation = "zones"
+)
+
+// Default values of the zones ground segmentation.
+const (
+	GroundZoneSizeDefault = 1000.
+	// zoneFitIterations is the number of times the local ground of a zone is fit again to the points on it.
+	zoneFitIterations = 3
+	// zoneSeedPoints is the number of lowest points of a zone whose mean height is where the ground is
+	// looked for.
+	zoneSeedPoints = 20
+)
+
+// localGround is the ground of a zone, z = a*x + b*y + c in the ground frame of the configured normal.
+type localGround struct {
+	a, b, c float64
+}
+
+// height returns the height of the local ground below a point of the ground frame.
+func (g localGround) height(p r3.Vector) float64 {
+	return g.a*p.X + g.b*p.Y + g.c
+}
+
+// fitLocalGround returns the least squares fit of z = a*x + b*y + c to the points. It returns false if the
+// points are all on a line, which does not make a ground.
+func fitLocalGround(pts []r3.Vector) (localGround, bool) {
+	var mean r3.Vector
+	for _, p := range pts {
+		mean = mean.Add(p)
+	}
+	mean = mean.Mul(1 / float64(len(pts)))
+	var sxx, sxy, syy, sxz, syz float64
+	for _, p := range pts {
+		d := p.Sub(mean)
+		sxx += d.X * d.X
+		sxy += d.X * d.Y
+		syy += d.Y * d.Y
+		sxz += d.X * d.Z
+		syz += d.Y * d.Z
+	}
+	det := sxx*syy - sxy*sxy
+	if math.Abs(det) < 1e-9*math.Max(1, sxx*syy) {
+		return localGround{}, false
+	}
+	a := (sxz*syy - syz*sxy) / det
+	b := (syz*sxx - sxz*sxy) / det
+	return localGround{a: a, b: b, c: mean.Z - a*mean.X - b*mean.Y}, true
+}
+
+// zoneIndex returns the ring and the sector of a point of the ground frame, and the number of sectors of the
+// ring. The sectors are about as long as the rings are wide.
+func zoneIndex(p r3.Vector, size float64) (ring, sector, sectors int) {
+	r := math.Hypot(p.X, p.Y)
+	ring = int(r / size)
+	sectors = ringSectors(ring)
+	angle := math.Atan2(p.Y, p.X) + math.Pi
+	sector = min(sectors-1, int(angle/(2*math.Pi)*float64(sectors)))
+	return ring, sector, sectors
+}
+
+// ringSectors returns the number of sectors of a ring.
+func ringSectors(ring int) int {
+	return max(1, int(math.Ceil(2*math.Pi*(float64(ring)+0.5))))
+}
+
+// segmentTerrain separates the ground from the obstacles with a local ground for each zone around the sensor,
+// at the given position in the frame of the cloud.
+// The ground of a zone is fit to its lowest points, and is rejected if it is steeper than cfg.AngleTolerance or if
+// it does not meet the ground of the zone inside it, which happens when an obstacle covers the zone. The zones
+// without a ground of their own use the ground of the zone inside them. The points within cfg.MaxDistFromPlane
+// of their local ground are the ground, returned as a plane fit to all of them; if there are not more than
+// cfg.MinPtsInPlane of them, no plane is returned and all the points are kept.
+func segmentTerrain(
+	ctx context.Context, cloud pc.PointCloud, sensor r3.Vector, cfg *ErCCLConfig,
+) (pc.Plane, pc.PointCloud, error) {
+	frame := newGroundFrame(cfg.NormalVec)
+	frame.origin = sensor
+	type zonePoint struct {
+		p, aligned r3.Vector
+		d          pc.Data
+	}
+	type zoneKey struct{ ring, sector int }
+	zones := make(map[zoneKey][]zonePoint)
+	maxRing := 0
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		aligned := frame.fromSensor(p)
+		ring, sector, _ := zoneIndex(aligned, cfg.GroundZoneSize)
+		zones[zoneKey{ring, sector}] = append(zones[zoneKey{ring, sector}], zonePoint{p, aligned, d})
+		maxRing = max(maxRing, ring)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	maxSlope := math.Tan(cfg.AngleTolerance * math.Pi / 180)
+	grounds := make(map[zoneKey]localGround)
+	ground := pc.NewBasicEmpty()
+	nonGround := pc.NewBasicEmpty()
+	var groundAligned []r3.Vector
+	// the zones are done from the sensor out, so the zone inside each one is done before it
+	for ring := 0; ring <= maxRing; ring++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		sectors := ringSectors(ring)
+		for sector := range sectors {
+			key := zoneKey{ring, sector}
+			points := zones[key]
+			// the zone inside this one, in the direction of the middle of this one
+			angle := (float64(sector)+0.5)/float64(sectors)*2*math.Pi - math.Pi
+			middle := r3.Vector{X: math.Cos(angle), Y: math.Sin(angle)}.Mul((float64(ring) + 0.5) * cfg.GroundZoneSize)
+			inner, hasInner := localGround{}, false
+			if ring > 0 {
+				_, innerSector, _ := zoneIndex(middle.Mul((float64(ring)-0.5)/(float64(ring)+0.5)), cfg.GroundZoneSize)
+				inner, hasInner = grounds[zoneKey{ring - 1, innerSector}]
+			}
+
+			aligned := make([]r3.Vector, len(points))
+			for i, zp := range points {
+				aligned[i] = zp.aligned
+			}
+			local, ok := zoneGround(aligned, cfg.MaxDistFromPlane)
+			if ok && math.Hypot(local.a, local.b) > maxSlope {
+				ok = false
+			}
+			// a ground that does not meet the one inside is the top of an obstacle
+			step := math.Abs(local.height(middle) - inner.height(middle))
+			if ok && hasInner && step > cfg.GroundZoneSize*maxSlope+cfg.MaxDistFromPlane {
+				ok = false
+			}
+			if !ok && hasInner {
+				local, ok = inner, true
+			}
+			if ok {
+				grounds[key] = local
+			}
+			for _, zp := range points {
+				if ok && math.Abs(zp.aligned.Z-local.height(zp.aligned)) < cfg.MaxDistFromPlane {
+					groundAligned = append(groundAligned, zp.aligned)
+					err = ground.Set(zp.p, zp.d)
+				} else {
+					err = nonGround.Set(zp.p, zp.d)
+				}
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+	if ground.Size() <= cfg.MinPtsInPlane {
+		return nil, cloud, nil
+	}
+
+	// the plane of all the ground, in the sensor frame
+	fit, ok := fitLocalGround(groundAligned)
+	if !ok {
+		return nil, cloud, nil
+	}
+	normal := frame.directionToSensor(r3.Vector{X: -fit.a, Y: -fit.b, Z: 1})
+	norm := normal.Norm()
+	equation := [4]float64{normal.X / norm, normal.Y / norm, normal.Z / norm, -(fit.c + normal.Dot(sensor)) / norm}
+	return pc.NewPlaneWithCenter(ground, equation, pc.CloudCentroid(ground)), nonGround, nil
+}
+
+// zoneGround fits the local ground of a zone to its lowest points, then again to the points within maxDist of
+// the fit. It returns false if the points of the zone do not make a ground.
+func zoneGround(points []r3.Vector, maxDist float64) (localGround, bool) {
+	if len(points) < 3 {
+		return localGround{}, false
+	}
+	heights := make([]float64, len(points))
+	for i, p := range points {
+		heights[i] = p.Z
+	}
+	sort.Float64s(heights)
+	seedHeight := 0.
+	n := min(zoneSeedPoints, len(heights))
+	for _, h := range heights[:n] {
+		seedHeight += h
+	}
+	seedHeight /= float64(n)
+
+	var on []r3.Vector
+	for _, p := range points {
+		if p.Z < seedHeight+maxDist {
+			on = append(on, p)
+		}
+	}
+	local, ok := fitLocalGround(on)
+	if !ok {
+		return localGround{}, false
+	}
+	for range zoneFitIterations - 1 {
+		on = on[:0]
+		for _, p := range points {
+			if math.Abs(p.Z-local.height(p)) < maxDist {
+				on = append(on, p)
+			}
+		}
+		refit, ok := fitLocalGround(on)
+		if !ok {
+			break
+		}
+		local = refit
+	}
+	return local, true
+}
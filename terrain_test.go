@@ -0,0 +1,70 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+// hillScene builds a cloud of rolling ground 1 m below the sensor, with a rock on a hillside.
+func hillScene(t *testing.T) (pc.PointCloud, r3.Vector) {
+	t.Helper()
+	s := scene{
+		groundMin:  r3.Vector{X: -4000, Y: -4000},
+		groundMax:  r3.Vector{X: 4000, Y: 4000},
+		groundStep: 50,
+		height: func(x, _ float64) float64 {
+			return -1000 + 300*math.Sin(x/1500)
+		},
+		boxes: []sceneBox{{
+			min:  r3.Vector{X: 2000, Y: 1000, Z: 50},
+			max:  r3.Vector{X: 2100, Y: 1100, Z: 150},
+			step: r3.Vector{X: 10, Y: 10, Z: 10},
+		}},
+	}
+	return s.cloud(t), s.centers()[0]
+}
+
+func TestSegmentTerrain(t *testing.T) {
+	cloud, rock := hillScene(t)
+	cfg := &ErCCLConfig{MinPtsInPlane: 500, MinPtsInSegment: 20, MaxDistFromPlane: 30, ClusteringRadius: 5, GridResolution: 20}
+	cfg.SetDefaultValues()
+	test.That(t, cfg.GroundSegmentation, test.ShouldEqual, GroundPlane)
+
+	// one plane does not fit the hills, they come back as obstacles
+	res, err := segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(res.objects), test.ShouldBeGreaterThan, 1)
+
+	// the local grounds do, only the rock is left
+	cfg.GroundSegmentation = GroundZones
+	res, err = segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.objects, test.ShouldHaveLength, 1)
+	center := res.objects[0].Geometry.Pose().Point()
+	test.That(t, center.X, test.ShouldAlmostEqual, rock.X, 10)
+	test.That(t, center.Y, test.ShouldAlmostEqual, rock.Y, 10)
+	test.That(t, center.Z, test.ShouldAlmostEqual, rock.Z, 20)
+	test.That(t, res.objects[0].PointCloud.Size(), test.ShouldBeBetweenOrEqual, 11*11*10, 11*11*11)
+	test.That(t, res.plane, test.ShouldNotBeNil)
+	test.That(t, res.ground.normal.Z, test.ShouldAlmostEqual, 1, 1e-2)
+}
+
+func TestFitLocalGround(t *testing.T) {
+	pts := []r3.Vector{{X: 0, Y: 0, Z: 1}, {X: 10, Y: 0, Z: 3}, {X: 0, Y: 10, Z: 0}, {X: 10, Y: 10, Z: 2}}
+	g, ok := fitLocalGround(pts)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, g.a, test.ShouldAlmostEqual, 0.2, 1e-9)
+	test.That(t, g.b, test.ShouldAlmostEqual, -0.1, 1e-9)
+	test.That(t, g.c, test.ShouldAlmostEqual, 1, 1e-9)
+	// points on a line do not make a ground
+	_, ok = fitLocalGround([]r3.Vector{{X: 0, Z: 1}, {X: 10, Z: 3}, {X: 20, Z: 5}})
+	test.That(t, ok, test.ShouldBeFalse)
+	_, ok = fitLocalGround([]r3.Vector{{X: 0, Z: 1}})
+	test.That(t, ok, test.ShouldBeFalse)
+}
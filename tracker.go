@@ -0,0 +1,266 @@
+package obstaclespointcloud
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/geo/r3"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/spatialmath"
+	"go.viam.com/rdk/vision"
+)
+
+// Default values of the tracker.
+const (
+	TrackConfirmHitsDefault = 3
+	TrackMaxMissesDefault   = 5
+	TrackMaxDistanceDefault = 500.
+	// TrackProcessNoiseDefault is the standard deviation of the accelerations of the obstacles in mm/s², and
+	// TrackMeasurementNoiseDefault the one of the measured centers in mm.
+	TrackProcessNoiseDefault     = 1000.
+	TrackMeasurementNoiseDefault = 50.
+)
+
+// TrackerConfig specifies how obstacles are matched across calls.
+type TrackerConfig struct {
+	// ConfirmHits is the number of times an obstacle has to be seen before its track is created and given an ID.
+	ConfirmHits int
+	// MaxMisses is the number of calls in a row an obstacle can be missing before its track is dropped.
+	MaxMisses int
+	// MaxDistance is the distance in mm that the center of an obstacle can move between two calls
+	// and still be matched, if it does not overlap its previous position.
+	MaxDistance float64
+	// ProcessNoise is the standard deviation of the accelerations of the obstacles in mm/s², used by the
+	// constant velocity filter of each track.
+	ProcessNoise float64
+	// MeasurementNoise is the standard deviation of the measured centers of the obstacles in mm.
+	MeasurementNoise float64
+}
+
+// SetDefaultValues sets the default values for the TrackerConfig.
+func (cfg *TrackerConfig) SetDefaultValues() {
+	if cfg.ConfirmHits <= 0 {
+		cfg.ConfirmHits = TrackConfirmHitsDefault
+	}
+	if cfg.MaxMisses <= 0 {
+		cfg.MaxMisses = TrackMaxMissesDefault
+	}
+	if cfg.MaxDistance <= 0 {
+		cfg.MaxDistance = TrackMaxDistanceDefault
+	}
+	if cfg.ProcessNoise <= 0 {
+		cfg.ProcessNoise = TrackProcessNoiseDefault
+	}
+	if cfg.MeasurementNoise <= 0 {
+		cfg.MeasurementNoise = TrackMeasurementNoiseDefault
+	}
+}
+
+// track is an obstacle followed across calls.
+type track struct {
+	// id is 0 until the track is confirmed
+	id int
+	// age is the number of calls since the obstacle was first seen, hits the number of them it was seen in,
+	// and misses the number of calls in a row it has been missing from
+	age, hits, misses int
+	center            r3.Vector
+	minPt, maxPt      r3.Vector
+	object            *vision.Object
+	// filter estimates the velocity of the obstacle from its centers
+	filter *constantVelocityFilter
+}
+
+// tracker matches the obstacles of each call to the ones of the previous calls by their centers and overlap,
+// so that an obstacle keeps the same ID in its label over time.
+type tracker struct {
+	mu     sync.Mutex
+	cfg    TrackerConfig
+	tracks []*track
+	nextID int
+	// last is the time of the last update
+	last time.Time
+}
+
+// newTracker returns a tracker with no tracks.
+func newTracker(cfg TrackerConfig) *tracker {
+	cfg.SetDefaultValues()
+	return &tracker{cfg: cfg, nextID: 1}
+}
+
+// trackLabel returns the label of an object of a confirmed track, with the ID, age and hits of the track.
+func trackLabel(t *track, label string) string {
+	tag := fmt.Sprintf("track-%d age-%d hits-%d", t.id, t.age, t.hits)
+	if label == "" {
+		return tag
+	}
+	return label + " " + tag
+}
+
+// update matches the objects found by a call to the tracks, and returns them with the ID, age and hits of their track
+// in the label once it is confirmed. Objects of tracks that are not confirmed yet are returned unchanged.
+// The objects are matched to where the filter of each track predicts it to be at now.
+func (tr *tracker) update(objects []*vision.Object, now time.Time) []*vision.Object {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	dt := 0.
+	if !tr.last.IsZero() {
+		dt = now.Sub(tr.last).Seconds()
+	}
+	tr.last = now
+	for _, t := range tr.tracks {
+		t.filter.predict(dt)
+	}
+
+	detections := make([]*track, 0, len(objects))
+	for _, obj := range objects {
+		detections = append(detections, newDetection(obj))
+	}
+
+	// score every pair that overlaps or is close enough, then match greedily from the best pair
+	type pair struct {
+		t, d     int
+		overlap  float64
+		distance float64
+	}
+	var pairs []pair
+	for i, t := range tr.tracks {
+		predicted := t.filter.position()
+		shift := predicted.Sub(t.center)
+		for j, d := range detections {
+			overlap := boxOverlap(t.minPt.Add(shift), t.maxPt.Add(shift), d.minPt, d.maxPt)
+			distance := predicted.Distance(d.center)
+			if overlap > 0 || distance <= tr.cfg.MaxDistance {
+				pairs = append(pairs, pair{t: i, d: j, overlap: overlap, distance: distance})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		if pairs[a].overlap != pairs[b].overlap {
+			return pairs[a].overlap > pairs[b].overlap
+		}
+		return pairs[a].distance < pairs[b].distance
+	})
+	trackMatched := make([]bool, len(tr.tracks))
+	detectionMatched := make([]bool, len(detections))
+	for _, p := range pairs {
+		if trackMatched[p.t] || detectionMatched[p.d] {
+			continue
+		}
+		trackMatched[p.t], detectionMatched[p.d] = true, true
+		t, d := tr.tracks[p.t], detections[p.d]
+		t.hits++
+		t.misses = 0
+		t.center, t.minPt, t.maxPt, t.object = d.center, d.minPt, d.maxPt, d.object
+		t.filter.correct(d.center)
+	}
+
+	// age every track, drop the ones that have been missing for too long
+	kept := tr.tracks[:0]
+	for i, t := range tr.tracks {
+		t.age++
+		if !trackMatched[i] {
+			t.misses++
+			if t.misses >= tr.cfg.MaxMisses {
+				continue
+			}
+		}
+		kept = append(kept, t)
+	}
+	tr.tracks = kept
+	for j, d := range detections {
+		if !detectionMatched[j] {
+			d.filter = newConstantVelocityFilter(d.center, tr.cfg.ProcessNoise, tr.cfg.MeasurementNoise)
+			tr.tracks = append(tr.tracks, d)
+		}
+	}
+
+	results := make([]*vision.Object, 0, len(objects))
+	for _, t := range tr.tracks {
+		if t.id == 0 && t.hits >= tr.cfg.ConfirmHits {
+			t.id = tr.nextID
+			tr.nextID++
+		}
+		if t.misses > 0 {
+			continue
+		}
+		if t.id != 0 {
+			t.object.Geometry.SetLabel(trackLabel(t, t.object.Geometry.Label()))
+		}
+		results = append(results, t.object)
+	}
+	return results
+}
+
+// newDetection returns a new track seen once, for an object.
+func newDetection(obj *vision.Object) *track {
+	d := &track{age: 1, hits: 1, object: obj}
+	if obj.PointCloud != nil && obj.PointCloud.Size() > 0 {
+		meta := obj.PointCloud.MetaData()
+		d.minPt = r3.Vector{X: meta.MinX, Y: meta.MinY, Z: meta.MinZ}
+		d.maxPt = r3.Vector{X: meta.MaxX, Y: meta.MaxY, Z: meta.MaxZ}
+		d.center = pc.CloudCentroid(obj.PointCloud)
+	} else if obj.Geometry != nil {
+		d.center = obj.Geometry.Pose().Point()
+		d.minPt, d.maxPt = d.center, d.center
+	}
+	return d
+}
+
+// boxOverlap returns the intersection over union of two axis aligned boxes.
+func boxOverlap(minA, maxA, minB, maxB r3.Vector) float64 {
+	intersection := math.Max(0, math.Min(maxA.X, maxB.X)-math.Max(minA.X, minB.X)) *
+		math.Max(0, math.Min(maxA.Y, maxB.Y)-math.Max(minA.Y, minB.Y)) *
+		math.Max(0, math.Min(maxA.Z, maxB.Z)-math.Max(minA.Z, minB.Z))
+	if intersection == 0 {
+		return 0
+	}
+	volume := func(minPt, maxPt r3.Vector) float64 {
+		return (maxPt.X - minPt.X) * (maxPt.Y - minPt.Y) * (maxPt.Z - minPt.Z)
+	}
+	return intersection / (volume(minA, maxA) + volume(minB, maxB) - intersection)
+}
+
+// trackInfo is what is reported about a confirmed track.
+type trackInfo struct {
+	ID     int
+	Label  string
+	Age    int
+	Hits   int
+	Center r3.Vector
+	// Position and Velocity are estimated by the filter of the track, in mm and mm/s, and Covariance
+	// is the covariance of (x, y, z, vx, vy, vz)
+	Position   r3.Vector
+	Velocity   r3.Vector
+	Covariance [6][6]float64
+	Geometry   spatialmath.Geometry
+}
+
+// confirmedTracks returns the confirmed tracks that were seen in the last call, in the order of their IDs.
+func (tr *tracker) confirmedTracks() []trackInfo {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	infos := []trackInfo{}
+	for _, t := range tr.tracks {
+		if t.id == 0 || t.misses > 0 {
+			continue
+		}
+		infos = append(infos, trackInfo{
+			ID:         t.id,
+			Label:      t.object.Geometry.Label(),
+			Age:        t.age,
+			Hits:       t.hits,
+			Center:     t.center,
+			Position:   t.filter.position(),
+			Velocity:   t.filter.velocity(),
+			Covariance: t.filter.covariance(),
+			Geometry:   t.object.Geometry,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
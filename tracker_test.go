@@ -0,0 +1,178 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	"go.viam.com/rdk/components/camera"
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/resource"
+	svision "go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision"
+)
+
+// cubeObject returns an object of the points of a cube of side 100 around center.
+func cubeObject(t *testing.T, center r3.Vector) *vision.Object {
+	t.Helper()
+	cloud := pc.NewBasicEmpty()
+	for x := -50.; x <= 50; x += 25 {
+		for y := -50.; y <= 50; y += 25 {
+			for z := -50.; z <= 50; z += 25 {
+				test.That(t, cloud.Set(center.Add(r3.Vector{X: x, Y: y, Z: z}), pc.NewBasicData()), test.ShouldBeNil)
+			}
+		}
+	}
+	obj, err := vision.NewObjectWithLabel(cloud, "", nil)
+	test.That(t, err, test.ShouldBeNil)
+	return obj
+}
+
+// labels returns the label of every object by the x of its center, which is unique in these tests.
+func labels(objects []*vision.Object) map[float64]string {
+	byX := make(map[float64]string, len(objects))
+	for _, obj := range objects {
+		byX[pc.CloudCentroid(obj.PointCloud).X] = obj.Geometry.Label()
+	}
+	return byX
+}
+
+func TestTracker(t *testing.T) {
+	tr := newTracker(TrackerConfig{ConfirmHits: 3, MaxMisses: 2, MaxDistance: 300})
+	// a still obstacle and one moving 150mm a call, which no longer overlaps its last position
+	frame := func(k int, withMoving bool) []*vision.Object {
+		objects := []*vision.Object{cubeObject(t, r3.Vector{X: 0, Y: 1000})}
+		if withMoving {
+			objects = append(objects, cubeObject(t, r3.Vector{X: 2000 + 150*float64(k), Y: 0}))
+		}
+		return objects
+	}
+	// the calls are 100ms apart
+	at := func(k int) time.Time {
+		return time.Unix(0, 0).Add(time.Duration(k) * 100 * time.Millisecond)
+	}
+
+	// tracks are not created until the obstacles are seen 3 times
+	for k := range 2 {
+		got := labels(tr.update(frame(k, true), at(k)))
+		test.That(t, got, test.ShouldHaveLength, 2)
+		for _, label := range got {
+			test.That(t, label, test.ShouldEqual, "")
+		}
+		test.That(t, tr.confirmedTracks(), test.ShouldBeEmpty)
+	}
+	for k := 2; k < 5; k++ {
+		got := labels(tr.update(frame(k, true), at(k)))
+		test.That(t, got[0], test.ShouldEqual, fmt.Sprintf("track-1 age-%d hits-%d", k+1, k+1))
+		test.That(t, got[2000+150*float64(k)], test.ShouldEqual, fmt.Sprintf("track-2 age-%d hits-%d", k+1, k+1))
+	}
+	tracks := tr.confirmedTracks()
+	test.That(t, tracks, test.ShouldHaveLength, 2)
+	test.That(t, tracks[1].ID, test.ShouldEqual, 2)
+	test.That(t, tracks[1].Age, test.ShouldEqual, 5)
+	test.That(t, tracks[1].Hits, test.ShouldEqual, 5)
+	test.That(t, tracks[1].Center.X, test.ShouldAlmostEqual, 2600)
+
+	// a missed call keeps the track, and it is matched again
+	got := labels(tr.update(frame(5, false), at(5)))
+	test.That(t, got, test.ShouldHaveLength, 1)
+	test.That(t, tr.confirmedTracks(), test.ShouldHaveLength, 1)
+	got = labels(tr.update(frame(6, true), at(6)))
+	test.That(t, got[2000+150*6], test.ShouldEqual, "track-2 age-7 hits-6")
+	tracks = tr.confirmedTracks()
+	test.That(t, tracks[1].Age, test.ShouldEqual, 7)
+	test.That(t, tracks[1].Hits, test.ShouldEqual, 6)
+
+	// after 2 misses the track is dropped, and the obstacle gets a new one
+	tr.update(frame(7, false), at(7))
+	tr.update(frame(8, false), at(8))
+	for k := 9; k < 12; k++ {
+		got = labels(tr.update(frame(k, true), at(k)))
+	}
+	test.That(t, got[0], test.ShouldEqual, "track-1 age-12 hits-12")
+	test.That(t, got[2000+150*11], test.ShouldEqual, "track-3 age-3 hits-3")
+}
+
+func TestTrackerLabels(t *testing.T) {
+	tr := newTracker(TrackerConfig{ConfirmHits: 1})
+	obj := cubeObject(t, r3.Vector{})
+	obj.Geometry.SetLabel(DegradedLabel)
+	got := tr.update([]*vision.Object{obj}, time.Now())
+	test.That(t, got[0].Geometry.Label(), test.ShouldEqual, "degraded track-1 age-1 hits-1")
+	test.That(t, boxOverlap(r3.Vector{}, r3.Vector{X: 2, Y: 2, Z: 2}, r3.Vector{X: 1, Y: 1, Z: 1}, r3.Vector{X: 3, Y: 3, Z: 3}),
+		test.ShouldAlmostEqual, 1./15)
+}
+
+func TestTrackingService(t *testing.T) {
+	cloud, _ := tiltedScene(t, r3.Vector{X: 0, Y: 0, Z: 1})
+	next := func(ctx context.Context, _ map[string]interface{}) (pc.PointCloud, error) {
+		return cloud, nil
+	}
+	cam := inject.NewCamera("fakeCamera")
+	cam.NextPointCloudFunc = next
+	other := inject.NewCamera("otherCamera")
+	other.NextPointCloudFunc = next
+	deps := resource.Dependencies{camera.Named("fakeCamera"): cam, camera.Named("otherCamera"): other}
+	params := &ObstaclesPointCloudConfig{
+		MinPtsInPlane:    500,
+		MinPtsInSegment:  20,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 10,
+		DefaultCamera:    "fakeCamera",
+	}
+	name := svision.Named("test_tracking")
+
+	// tracking is off by default
+	service, err := registerPointCloudSegmenter(context.Background(), name, params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = service.DoCommand(context.Background(), map[string]interface{}{"command": "get_tracks"})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "tracking is not enabled")
+	_, err = service.DoCommand(context.Background(), map[string]interface{}{"command": "dance"})
+	test.That(t, err.Error(), test.ShouldContainSubstring, "unknown command")
+
+	params.Tracking = true
+	params.TrackConfirmHits = 2
+	service, err = registerPointCloudSegmenter(context.Background(), name, params, deps, nil)
+	test.That(t, err, test.ShouldBeNil)
+	for range 2 {
+		objects, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, objects, test.ShouldHaveLength, 2)
+	}
+	resp, err := service.DoCommand(context.Background(), map[string]interface{}{"command": "get_tracks"})
+	test.That(t, err, test.ShouldBeNil)
+	tracks := resp["tracks"].([]interface{})
+	test.That(t, tracks, test.ShouldHaveLength, 2)
+	first := tracks[0].(map[string]interface{})
+	test.That(t, first["id"], test.ShouldEqual, 1)
+	test.That(t, first["hits"], test.ShouldEqual, 2)
+	test.That(t, first["label"], test.ShouldEqual, "frame:fakeCamera track-1 age-2 hits-2")
+	test.That(t, first["velocity"], test.ShouldNotBeNil)
+	test.That(t, first["covariance"], test.ShouldHaveLength, 36)
+	geometry := first["geometry"].(map[string]interface{})
+	test.That(t, geometry["box"], test.ShouldNotBeNil)
+	test.That(t, geometry["label"], test.ShouldEqual, "frame:fakeCamera track-1 age-2 hits-2")
+
+	// each camera has its own tracks, the ones of the other camera are not missing from its calls
+	cmd := map[string]interface{}{"command": "get_tracks", "camera_name": "otherCamera"}
+	resp, err = service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["tracks"], test.ShouldBeEmpty)
+	for range 3 {
+		_, err := service.GetObjectPointClouds(context.Background(), "otherCamera", nil)
+		test.That(t, err, test.ShouldBeNil)
+	}
+	resp, err = service.DoCommand(context.Background(), cmd)
+	test.That(t, err, test.ShouldBeNil)
+	first = resp["tracks"].([]interface{})[0].(map[string]interface{})
+	test.That(t, first["label"], test.ShouldEqual, "frame:otherCamera track-1 age-3 hits-3")
+	objects, err := service.GetObjectPointClouds(context.Background(), "fakeCamera", nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, objects[0].Geometry.Label(), test.ShouldStartWith, "frame:fakeCamera track-")
+	test.That(t, objects[0].Geometry.Label(), test.ShouldEndWith, "age-3 hits-3")
+}
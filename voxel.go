@@ -0,0 +1,140 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang/geo/r3"
+
+	pc "go.viam.com/rdk/pointcloud"
+	"go.viam.com/rdk/vision"
+)
+
+// VoxelMode is how the points of a voxel are replaced by one point when the cloud is downsampled.
+type VoxelMode string
+
+// The voxel modes. The centroid is the mean of the points of the voxel, with the data of its first point. The
+// first point is the first point of the voxel met when iterating over the cloud, which is faster and keeps
+// the points on the surfaces that were seen.
+const (
+	VoxelCentroid VoxelMode = "centroid"
+	VoxelFirst    VoxelMode = "first"
+)
+
+// voxelKey is the index of a voxel along each axis.
+type voxelKey struct{ x, y, z int64 }
+
+// voxelGrid is a point cloud downsampled to one point per voxel. It keeps the points of each voxel if the
+// objects are asked for at full resolution.
+type voxelGrid struct {
+	size float64
+	// counts are the number of points of the original cloud in each voxel
+	counts map[voxelKey]int
+	// points are the points of the original cloud in each voxel, nil if they are not kept
+	points map[voxelKey][]voxelPoint
+}
+
+type voxelPoint struct {
+	p r3.Vector
+	d pc.Data
+}
+
+// key returns the voxel of a point.
+func (g *voxelGrid) key(p r3.Vector) voxelKey {
+	return voxelKey{
+		x: int64(math.Floor(p.X / g.size)),
+		y: int64(math.Floor(p.Y / g.size)),
+		z: int64(math.Floor(p.Z / g.size)),
+	}
+}
+
+// voxelDownsample returns the cloud with one point per voxel of size mm, and the grid of the voxels. The points
+// of each voxel are kept in the grid if keepPoints is set.
+func voxelDownsample(
+	ctx context.Context, cloud pc.PointCloud, size float64, mode VoxelMode, keepPoints bool,
+) (pc.PointCloud, *voxelGrid, error) {
+	grid := &voxelGrid{size: size, counts: make(map[voxelKey]int)}
+	if keepPoints {
+		grid.points = make(map[voxelKey][]voxelPoint)
+	}
+	type voxel struct {
+		first voxelPoint
+		sum   r3.Vector
+		count int
+	}
+	voxels := make(map[voxelKey]*voxel)
+	// the order the voxels are met in, so the downsampled cloud does not depend on the order of the map
+	var order []voxelKey
+	err := iterateWithContext(ctx, cloud, func(p r3.Vector, d pc.Data) bool {
+		k := grid.key(p)
+		v, ok := voxels[k]
+		if !ok {
+			v = &voxel{first: voxelPoint{p, d}}
+			voxels[k] = v
+			order = append(order, k)
+		}
+		v.sum = v.sum.Add(p)
+		v.count++
+		grid.counts[k]++
+		if keepPoints {
+			grid.points[k] = append(grid.points[k], voxelPoint{p, d})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sampled := pc.NewBasicPointCloud(len(order))
+	for i, k := range order {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		v := voxels[k]
+		p := v.first.p
+		if mode == VoxelCentroid {
+			p = v.sum.Mul(1 / float64(v.count))
+		}
+		if err := sampled.Set(p, v.first.d); err != nil {
+			return nil, nil, err
+		}
+	}
+	return sampled, grid, nil
+}
+
+// fullResolution replaces the points of each object by all the points of the original cloud in the voxels
+// of its points. The geometries of the objects are kept, they were built from the downsampled points.
+func (g *voxelGrid) fullResolution(ctx context.Context, objects []*vision.Object) error {
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		full := pc.NewBasicEmpty()
+		var setErr error
+		object.PointCloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+			for _, vp := range g.points[g.key(p)] {
+				if setErr = full.Set(vp.p, vp.d); setErr != nil {
+					return false
+				}
+			}
+			return true
+		})
+		if setErr != nil {
+			return setErr
+		}
+		object.PointCloud = full
+	}
+	return nil
+}
+
+// pointCount returns the number of points of the original cloud in the voxels of the points of cloud.
+func (g *voxelGrid) pointCount(cloud pc.PointCloud) int {
+	n := 0
+	cloud.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		n += g.counts[g.key(p)]
+		return true
+	})
+	return n
+}
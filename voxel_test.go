@@ -0,0 +1,126 @@
+package obstaclespointcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/r3"
+	"go.viam.com/test"
+
+	pc "go.viam.com/rdk/pointcloud"
+)
+
+func TestVoxelDownsample(t *testing.T) {
+	cloud := pc.NewBasicEmpty()
+	// 8 points in the voxel at the origin, and one in the voxel next to it
+	for _, p := range []r3.Vector{
+		{X: 1, Y: 1, Z: 1}, {X: 9, Y: 1, Z: 1}, {X: 1, Y: 9, Z: 1}, {X: 9, Y: 9, Z: 1},
+		{X: 1, Y: 1, Z: 9}, {X: 9, Y: 1, Z: 9}, {X: 1, Y: 9, Z: 9}, {X: 9, Y: 9, Z: 9},
+		{X: -5, Y: 5, Z: 5},
+	} {
+		test.That(t, cloud.Set(p, pc.NewBasicData()), test.ShouldBeNil)
+	}
+
+	sampled, grid, err := voxelDownsample(context.Background(), cloud, 10, VoxelCentroid, false)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sampled.Size(), test.ShouldEqual, 2)
+	_, ok := sampled.At(5, 5, 5)
+	test.That(t, ok, test.ShouldBeTrue)
+	_, ok = sampled.At(-5, 5, 5)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, grid.points, test.ShouldBeNil)
+
+	sampled, grid, err = voxelDownsample(context.Background(), cloud, 10, VoxelFirst, true)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sampled.Size(), test.ShouldEqual, 2)
+	// the first point of the voxel met is one of its points
+	sampled.Iterate(0, 0, func(p r3.Vector, d pc.Data) bool {
+		_, ok := cloud.At(p.X, p.Y, p.Z)
+		test.That(t, ok, test.ShouldBeTrue)
+		return true
+	})
+	test.That(t, len(grid.points[voxelKey{0, 0, 0}]), test.ShouldEqual, 8)
+	test.That(t, len(grid.points[voxelKey{-1, 0, 0}]), test.ShouldEqual, 1)
+}
+
+func TestVoxelFullResolutionObjects(t *testing.T) {
+	cloud, centers := tiltedScene(t, r3.Vector{Z: 1})
+	cfg := &ErCCLConfig{
+		MinPtsInPlane:    100,
+		MinPtsInSegment:  5,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 5,
+		GridResolution:   20,
+		VoxelSize:        20,
+	}
+	cfg.SetDefaultValues()
+	objects, err := ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, len(centers))
+	downsampled := 0
+	for _, o := range objects {
+		downsampled += o.PointCloud.Size()
+	}
+	// each obstacle has 7 x 7 x 9 points, in fewer voxels
+	test.That(t, downsampled, test.ShouldBeLessThan, 2*7*7*9)
+
+	cfg.FullResolutionObjects = true
+	objects, err = ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, len(centers))
+	for _, o := range objects {
+		test.That(t, o.PointCloud.Size(), test.ShouldEqual, 7*7*9)
+	}
+}
+
+func TestVoxelMinPointsInPlane(t *testing.T) {
+	cloud, centers := tiltedScene(t, r3.Vector{Z: 1})
+	// the ground has 41 x 41 points, in fewer voxels than min_points_in_plane
+	cfg := &ErCCLConfig{
+		MinPtsInPlane:    1000,
+		MinPtsInSegment:  5,
+		MaxDistFromPlane: 5,
+		ClusteringRadius: 5,
+		GridResolution:   20,
+		VoxelSize:        20,
+	}
+	cfg.SetDefaultValues()
+	res, err := segmentERCCL(context.Background(), cloud, r3.Vector{}, cfg, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.plane, test.ShouldNotBeNil)
+	test.That(t, res.objects, test.ShouldHaveLength, len(centers))
+	test.That(t, cfg.MinPtsInPlane, test.ShouldEqual, 1000)
+}
+
+func TestVoxelDefaultGridResolution(t *testing.T) {
+	// a box of 90 x 90 x 230 mm on the ground, with voxels larger than the clustering radius in cells of the
+	// automatic resolution
+	cloud := scene{
+		groundMin:  r3.Vector{X: -500, Y: -500},
+		groundMax:  r3.Vector{X: 500, Y: 500},
+		groundStep: 10,
+		hole:       func(x, y float64) bool { return x >= 210 && x < 300 && y >= 210 && y < 300 },
+		boxes: []sceneBox{{
+			min:  r3.Vector{X: 210, Y: 210, Z: 20},
+			max:  r3.Vector{X: 298, Y: 298, Z: 250},
+			step: r3.Vector{X: 2, Y: 2, Z: 10},
+		}},
+	}.cloud(t)
+	boxPoints := 45 * 45 * 24
+	cfg := &ErCCLConfig{MaxDistFromPlane: 5, VoxelSize: 30}
+	cfg.SetDefaultValues()
+	objects, err := ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+
+	// the minimum size of an object counts the points of the cloud, not the voxels
+	test.That(t, objects[0].PointCloud.Size(), test.ShouldBeLessThan, 100)
+	cfg.MinPtsInSegment = boxPoints
+	objects, err = ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(objects), test.ShouldEqual, 1)
+	cfg.MinPtsInSegment = boxPoints + 1
+	objects, err = ApplyERCCLToPointCloud(context.Background(), cloud, cfg)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, objects, test.ShouldBeEmpty)
+}